@@ -0,0 +1,191 @@
+// Command ic reviews the pending snapshots recorded by running tests with
+// IC_UPDATE=pending.
+//
+// Usage:
+//
+//	ic review [--accept-all | --reject-all] [dir ...]
+//
+// Each pending snapshot under the given directories, or the current directory
+// when there are none, is shown as a diff and can be accepted into its test
+// file, rejected, or skipped to be reviewed later.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BestFriendChris/go-ic/ic"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: ic review [--accept-all | --reject-all] [dir ...]`
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "review" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("review", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		flags.PrintDefaults()
+	}
+	acceptAll := flags.Bool("accept-all", false, "accept every pending snapshot without asking")
+	rejectAll := flags.Bool("reject-all", false, "reject every pending snapshot without asking")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *acceptAll && *rejectAll {
+		fmt.Fprintln(stderr, "ic: --accept-all and --reject-all can't be used together")
+		return 2
+	}
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	tfu := ic.NewTestFileUpdater()
+	snapshots, err := findPendingSnapshots(tfu, dirs)
+	if err != nil {
+		fmt.Fprintf(stderr, "ic: %s\n", err)
+		return 1
+	}
+	if len(snapshots) == 0 {
+		fmt.Fprintln(stdout, "No pending snapshots")
+		return 0
+	}
+
+	r := reviewer{in: bufio.NewReader(stdin), out: stdout}
+	switch {
+	case *acceptAll:
+		r.accepted = snapshots
+	case *rejectAll:
+		r.rejected = snapshots
+	default:
+		r.review(snapshots)
+	}
+
+	exitCode := 0
+	for _, fileSnapshots := range groupByFile(r.accepted) {
+		if err = tfu.AcceptPending(fileSnapshots...); err != nil {
+			fmt.Fprintf(stderr, "ic: unable to accept snapshots: %s\n", err)
+			exitCode = 1
+		}
+	}
+	for _, fileSnapshots := range groupByFile(r.rejected) {
+		if err = tfu.RejectPending(fileSnapshots...); err != nil {
+			fmt.Fprintf(stderr, "ic: unable to reject snapshots: %s\n", err)
+			exitCode = 1
+		}
+	}
+	fmt.Fprintf(stdout, "%d accepted, %d rejected, %d skipped\n",
+		len(r.accepted), len(r.rejected), len(snapshots)-len(r.accepted)-len(r.rejected))
+	return exitCode
+}
+
+// findPendingSnapshots returns the pending snapshots of every test file under dirs
+func findPendingSnapshots(tfu ic.TestFileUpdater, dirs []string) ([]ic.PendingSnapshot, error) {
+	var snapshots []ic.PendingSnapshot
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || filepath.Base(filepath.Dir(path)) != ".ic-pending" || !strings.HasSuffix(path, ".ic.new") {
+				return nil
+			}
+			testFile := ic.PendingSnapshotTestFile(path)
+			if ic.PendingSnapshotPath(testFile) != filepath.Clean(path) {
+				return nil
+			}
+			fileSnapshots, err := tfu.PendingSnapshots(testFile)
+			if err != nil {
+				return err
+			}
+			snapshots = append(snapshots, fileSnapshots...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+// reviewer asks about each snapshot in turn, remembering the answers
+type reviewer struct {
+	in                 *bufio.Reader
+	out                io.Writer
+	accepted, rejected []ic.PendingSnapshot
+}
+
+func (r *reviewer) review(snapshots []ic.PendingSnapshot) {
+	for i, snapshot := range snapshots {
+		fmt.Fprintf(r.out, "\n%s:%d:%d (%d of %d)\n", snapshot.File, snapshot.Line, snapshot.Column, i+1, len(snapshots))
+		fmt.Fprintln(r.out, ic.FormatDiff(snapshot.Old, snapshot.New))
+		answer, err := r.ask()
+		if err != nil {
+			// Out of input, so leave the rest for next time
+			fmt.Fprintln(r.out)
+			return
+		}
+		switch answer {
+		case "a":
+			r.accepted = append(r.accepted, snapshot)
+		case "r":
+			r.rejected = append(r.rejected, snapshot)
+		}
+	}
+}
+
+// ask prompts until it gets an answer of "a", "r" or "s"
+func (r *reviewer) ask() (string, error) {
+	for {
+		fmt.Fprint(r.out, "accept (a), reject (r) or skip (s)? ")
+		line, err := r.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch answer {
+		case "a", "accept", "r", "reject", "s", "skip":
+			return answer[:1], nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", err
+			}
+			return "", fmt.Errorf("reading answer: %w", err)
+		}
+	}
+}
+
+func groupByFile(snapshots []ic.PendingSnapshot) [][]ic.PendingSnapshot {
+	byFile := make(map[string][]ic.PendingSnapshot)
+	var files []string
+	for _, snapshot := range snapshots {
+		if _, found := byFile[snapshot.File]; !found {
+			files = append(files, snapshot.File)
+		}
+		byFile[snapshot.File] = append(byFile[snapshot.File], snapshot)
+	}
+	sort.Strings(files)
+	grouped := make([][]ic.PendingSnapshot, len(files))
+	for i, file := range files {
+		grouped[i] = byFile[file]
+	}
+	return grouped
+}
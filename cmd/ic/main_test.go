@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BestFriendChris/go-ic/ic"
+)
+
+const testSrc = `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect("old")
+	c.Expect("other")
+}
+`
+
+const pendingSrc = `[
+  {"file": "foo_test.go", "line": 4, "column": 11, "old": "old", "new": "first\nsecond"},
+  {"file": "foo_test.go", "line": 5, "column": 11, "old": "other", "new": "third"}
+]`
+
+// writeTestDir creates a package holding foo_test.go and its pending snapshots
+func writeTestDir(t *testing.T) (dir, testFile string) {
+	t.Helper()
+	dir = t.TempDir()
+	testFile = filepath.Join(dir, "pkg", "foo_test.go")
+	pendingPath := ic.PendingSnapshotPath(testFile)
+	if err := os.MkdirAll(filepath.Dir(pendingPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(testFile, []byte(testSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pendingPath, []byte(pendingSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, testFile
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func Test_run_review(t *testing.T) {
+	dir, testFile := writeTestDir(t)
+	var stdout, stderr bytes.Buffer
+
+	// An unknown answer asks again, and running out of input skips the rest
+	exitCode := run([]string{"review", dir}, strings.NewReader("x\na\n"), &stdout, &stderr)
+
+	if exitCode != 0 {
+		t.Fatalf("got exit code %d: %s", exitCode, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		testFile + ":4:11 (1 of 2)",
+		"--- Got\n+++ Want\n",
+		"+old\n",
+		testFile + ":5:11 (2 of 2)",
+		` got: "third"` + "\n" + `want: "other"`,
+		"1 accepted, 0 rejected, 1 skipped",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q in:\n%s", want, out)
+		}
+	}
+	if got := strings.Count(out, "accept (a), reject (r) or skip (s)? "); got != 3 {
+		t.Errorf("got %d prompts, want 3", got)
+	}
+
+	wantSrc := `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(` + "`" + `
+		first
+		second` + "`" + `)
+	c.Expect("other")
+}
+`
+	if got := readFile(t, testFile); got != wantSrc {
+		t.Errorf("\n got: %s\nwant: %s", got, wantSrc)
+	}
+	pending := readFile(t, ic.PendingSnapshotPath(testFile))
+	if !strings.Contains(pending, `"line": 7`) || strings.Contains(pending, `"first`) {
+		t.Errorf("expected only the skipped snapshot to remain, moved to line 7:\n%s", pending)
+	}
+}
+
+func Test_run_acceptAll(t *testing.T) {
+	dir, testFile := writeTestDir(t)
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run([]string{"review", "--accept-all", dir}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != 0 {
+		t.Fatalf("got exit code %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "2 accepted, 0 rejected, 0 skipped") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+	if got := readFile(t, testFile); !strings.Contains(got, "first") || !strings.Contains(got, "`third`") {
+		t.Errorf("expected both snapshots to be accepted in:\n%s", got)
+	}
+	if _, err := os.Stat(ic.PendingSnapshotPath(testFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the pending snapshots to be removed: %v", err)
+	}
+}
+
+func Test_run_rejectAll(t *testing.T) {
+	dir, testFile := writeTestDir(t)
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run([]string{"review", "--reject-all", dir}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != 0 {
+		t.Fatalf("got exit code %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "0 accepted, 2 rejected, 0 skipped") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+	if got := readFile(t, testFile); got != testSrc {
+		t.Errorf("expected the test file to be left alone:\n%s", got)
+	}
+	if _, err := os.Stat(ic.PendingSnapshotPath(testFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the pending snapshots to be removed: %v", err)
+	}
+}
+
+func Test_run_usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"review", "--accept-all", "--reject-all"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(args, strings.NewReader(""), &stdout, &stderr); exitCode != 2 {
+			t.Errorf("%q: got exit code %d, want 2", args, exitCode)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("%q: expected an explanation on stderr", args)
+		}
+	}
+}
+
+func Test_run_nothingPending(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"review", t.TempDir()}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != 0 || stdout.String() != "No pending snapshots\n" {
+		t.Errorf("got exit code %d and output %q", exitCode, stdout.String())
+	}
+}
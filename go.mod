@@ -1,5 +1,3 @@
 module github.com/BestFriendChris/go-ic
 
 go 1.19
-
-require github.com/pmezard/go-difflib v1.0.0
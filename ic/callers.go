@@ -0,0 +1,53 @@
+package ic
+
+import (
+	"runtime"
+	"strings"
+)
+
+// callerFrame is a source position on the stack of the running test
+type callerFrame struct {
+	file string
+	line int
+}
+
+var icPackage = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	return funcPackage(runtime.FuncForPC(pc).Name())
+}()
+
+// testCallers returns the stack frames of the running test, starting with the
+// one that called into IC and ending before the testing package takes over.
+func testCallers() []callerFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var callers []callerFrame
+	for {
+		frame, more := frames.Next()
+		pkg := funcPackage(frame.Function)
+		if pkg == "testing" || pkg == "runtime" {
+			break
+		}
+		isIC := pkg == icPackage && !strings.HasSuffix(frame.File, "_test.go")
+		if !isIC || len(callers) > 0 {
+			callers = append(callers, callerFrame{file: frame.File, line: frame.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return callers
+}
+
+// funcPackage returns the import path of a fully qualified function name
+// such as "github.com/a/b.(*T).Method.func1"
+func funcPackage(funcName string) string {
+	lastSlash := strings.LastIndex(funcName, "/")
+	dot := strings.Index(funcName[lastSlash+1:], ".")
+	if dot == -1 {
+		return funcName
+	}
+	return funcName[:lastSlash+1+dot]
+}
@@ -0,0 +1,100 @@
+package ic
+
+import (
+	"strings"
+)
+
+// ANSI escape codes used to color diffs
+const (
+	ansiReset   = "\x1b[0m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiCyan    = "\x1b[36m"
+	ansiBold    = "\x1b[1m"
+	ansiReverse = "\x1b[7m"
+	ansiNoRev   = "\x1b[27m"
+)
+
+// colorDiff colors a diff made by formatDiff for a terminal. Removed lines
+// are red and added lines green. Instead of a line of carets, the characters
+// that changed within a line are shown in reverse video. Only unified diffs
+// and the single line form are colored.
+func colorDiff(diff string) string {
+	lines := strings.SplitAfter(diff, "\n")
+	// The single line form puts the caret lines under the quoted values,
+	// indented as far as they are
+	isSingleLine := strings.HasPrefix(diff, " got: ")
+	if !isSingleLine && !strings.HasPrefix(diff, "--- ") {
+		// Diffs from other Differs are left as they are
+		return diff
+	}
+	isCaretLine := func(line string) bool {
+		if isSingleLine {
+			return strings.HasPrefix(line, "      ") && strings.Contains(line, "^")
+		}
+		return strings.HasPrefix(line, "?")
+	}
+
+	var sb strings.Builder
+	isHeader := !isSingleLine
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		text := strings.TrimSuffix(line, "\n")
+		newline := line[len(text):]
+		if strings.HasPrefix(line, "@@") {
+			isHeader = false
+		}
+
+		var color string
+		switch {
+		case isHeader:
+			color = ansiBold
+		case strings.HasPrefix(line, "@@"):
+			color = ansiCyan
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, " got: "):
+			color = ansiRed
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, "want: "):
+			color = ansiGreen
+		}
+		if color == "" || text == "" {
+			sb.WriteString(line)
+			continue
+		}
+
+		if !isHeader && i+1 < len(lines) && isCaretLine(lines[i+1]) {
+			text = reverseMarked(text, strings.TrimSuffix(lines[i+1], "\n"))
+			i++
+			newline = "\n"
+			if i == len(lines)-1 && !strings.HasSuffix(lines[i], "\n") {
+				newline = ""
+			}
+		}
+		sb.WriteString(color + text + ansiReset + newline)
+	}
+	return sb.String()
+}
+
+// reverseMarked shows the characters of text that have a caret under them in
+// marks in reverse video
+func reverseMarked(text, marks string) string {
+	var sb strings.Builder
+	isReversed := false
+	i := 0
+	for _, r := range text {
+		isMarked := i < len(marks) && marks[i] == '^'
+		if isMarked != isReversed {
+			if isMarked {
+				sb.WriteString(ansiReverse)
+			} else {
+				sb.WriteString(ansiNoRev)
+			}
+			isReversed = isMarked
+		}
+		sb.WriteRune(r)
+		i++
+	}
+	if isReversed {
+		sb.WriteString(ansiNoRev)
+	}
+	return sb.String()
+}
@@ -0,0 +1,20 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_colorDiff(t *testing.T) {
+	diff := "--- Got\n+++ Want\n@@ -1,2 +1,2 @@\n-a 1\n?  ^\n+a 2\n?  ^\n--- b\n"
+	want := "\x1b[1m--- Got\x1b[0m\n" +
+		"\x1b[1m+++ Want\x1b[0m\n" +
+		"\x1b[36m@@ -1,2 +1,2 @@\x1b[0m\n" +
+		"\x1b[31m-a \x1b[7m1\x1b[27m\x1b[0m\n" +
+		"\x1b[32m+a \x1b[7m2\x1b[27m\x1b[0m\n" +
+		"\x1b[31m--- b\x1b[0m\n"
+	assertEqual(t, colorDiff(diff), want)
+}
+
+func Test_reverseMarked(t *testing.T) {
+	assertEqual(t, reverseMarked("\tab€d", "\t ^^"), "\ta\x1b[7mb€\x1b[27md")
+}
@@ -0,0 +1,138 @@
+package ic
+
+import (
+	"strings"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/diff"
+)
+
+// similarLineRatio is how alike two lines must be, as a diff.Ratio, to be
+// treated as one line that changed rather than two unrelated lines. It is the
+// cutoff Python's ndiff uses for the same purpose.
+const similarLineRatio = 0.75
+
+// maxHighlightedPairs limits the pairs of lines compared in each block of a
+// diff, so that rewriting a large file doesn't make the diff slow
+const maxHighlightedPairs = 10000
+
+// highlightChanges marks the characters that differ between the lines a and
+// b with carets, returning a line of markers to show under each. It returns
+// false when the lines are too different for the markers to help.
+func highlightChanges(a, b string) (aMarks, bMarks string, ok bool) {
+	aRunes, bRunes := splitRunes(a), splitRunes(b)
+	opCodes := diff.Myers(aRunes, bRunes)
+	if diff.Ratio(opCodes, aRunes, bRunes) < similarLineRatio {
+		return "", "", false
+	}
+	aChanged := make([]bool, len(aRunes))
+	bChanged := make([]bool, len(bRunes))
+	for _, op := range opCodes {
+		if op.Tag == 'e' {
+			continue
+		}
+		for i := op.I1; i < op.I2; i++ {
+			aChanged[i] = true
+		}
+		for j := op.J1; j < op.J2; j++ {
+			bChanged[j] = true
+		}
+	}
+	return caretLine(aRunes, aChanged), caretLine(bRunes, bChanged), true
+}
+
+func splitRunes(s string) []string {
+	runes := make([]string, 0, len(s))
+	for _, r := range s {
+		runes = append(runes, string(r))
+	}
+	return runes
+}
+
+// caretLine puts a caret under each changed character. Tabs are kept so the
+// carets line up with the line above them.
+func caretLine(runes []string, changed []bool) string {
+	var sb strings.Builder
+	for i, r := range runes {
+		switch {
+		case changed[i]:
+			sb.WriteByte('^')
+		case r == "\t":
+			sb.WriteByte('\t')
+		default:
+			sb.WriteByte(' ')
+		}
+	}
+	return strings.TrimRight(sb.String(), " \t")
+}
+
+// highlightUnifiedDiff adds a line of carets, starting with "?", under each
+// removed and added line of a unified diff that are a changed version of one
+// another. Each removed line is paired with the first similar line added in
+// its place, keeping the pairs in order.
+func highlightUnifiedDiff(diff string) string {
+	if !strings.HasPrefix(diff, "--- ") {
+		// Not a unified diff, so there are no lines to pair up
+		return diff
+	}
+	lines := strings.SplitAfter(diff, "\n")
+	var sb strings.Builder
+	// The "---" and "+++" headers come before the first hunk
+	i := 0
+	for i < len(lines) && !strings.HasPrefix(lines[i], "@@") {
+		sb.WriteString(lines[i])
+		i++
+	}
+	for i < len(lines) {
+		if !isDiffLine(lines[i], '-') {
+			sb.WriteString(lines[i])
+			i++
+			continue
+		}
+		removedEnd := i
+		for removedEnd < len(lines) && isDiffLine(lines[removedEnd], '-') {
+			removedEnd++
+		}
+		addedEnd := removedEnd
+		for addedEnd < len(lines) && isDiffLine(lines[addedEnd], '+') {
+			addedEnd++
+		}
+		removed, added := lines[i:removedEnd], lines[removedEnd:addedEnd]
+		removedMarks := make([]string, len(removed))
+		addedMarks := make([]string, len(added))
+		nextAdded := 0
+		if len(removed)*len(added) > maxHighlightedPairs {
+			nextAdded = len(added)
+		}
+		for k := range removed {
+			for l := nextAdded; l < len(added); l++ {
+				if aMarks, bMarks, ok := highlightChanges(diffLineText(removed[k]), diffLineText(added[l])); ok {
+					removedMarks[k], addedMarks[l] = aMarks, bMarks
+					nextAdded = l + 1
+					break
+				}
+			}
+		}
+		writeMarkedLines(&sb, removed, removedMarks)
+		writeMarkedLines(&sb, added, addedMarks)
+		i = addedEnd
+	}
+	return sb.String()
+}
+
+// isDiffLine reports whether line is a hunk line starting with prefix
+func isDiffLine(line string, prefix byte) bool {
+	return len(line) > 0 && line[0] == prefix
+}
+
+func diffLineText(line string) string {
+	return strings.TrimSuffix(line[1:], "\n")
+}
+
+func writeMarkedLines(sb *strings.Builder, lines, marks []string) {
+	for k, line := range lines {
+		sb.WriteString(line)
+		if marks[k] != "" {
+			sb.WriteString("?" + marks[k] + "\n")
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_highlightChanges(t *testing.T) {
+	tests := []struct {
+		name, a, b             string
+		wantAMarks, wantBMarks string
+		wantOk                 bool
+	}{
+		{"one character", "| 1 | 1.234 |", "| 1 | 1.235 |", "          ^", "          ^", true},
+		{"inserted word", "a b d", "a b c d", "", "    ^^", true},
+		{"tabs kept", "\tx = 1", "\tx = 2", "\t    ^", "\t    ^", true},
+		{"unrelated", "succeed", "fail", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aMarks, bMarks, ok := highlightChanges(tt.a, tt.b)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			assertEqual(t, aMarks, tt.wantAMarks)
+			assertEqual(t, bMarks, tt.wantBMarks)
+		})
+	}
+}
+
+func Test_highlightUnifiedDiff(t *testing.T) {
+	diff := `--- Got
++++ Want
+@@ -1,4 +1,3 @@
+ header
+--- a rule
+-value: 1.234
+-gone
++value: 1.235
++something else entirely
+`
+	want := `--- Got
++++ Want
+@@ -1,4 +1,3 @@
+ header
+--- a rule
+-value: 1.234
+?           ^
+-gone
++value: 1.235
+?           ^
++something else entirely
+`
+	assertEqual(t, highlightUnifiedDiff(diff), want)
+}
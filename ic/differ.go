@@ -0,0 +1,87 @@
+package ic
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/diff"
+)
+
+// Differ writes the line diff logged when a multiline expectation fails. The
+// changed characters of similar "-" and "+" lines in its diff are marked
+// afterwards, so it should write a unified diff to get them.
+type Differ interface {
+	// Diff returns a diff turning got into want, or "" when they are the same
+	Diff(got, want string) string
+}
+
+// MyersDiff returns a Differ writing unified diffs with context unchanged
+// lines around each change. Myers' algorithm finds the smallest diff, like
+// "diff" and "git diff" do. It is the default, with 3 lines of context.
+func MyersDiff(context int) Differ {
+	return unifiedDiffer{context: context, algorithm: diff.Myers}
+}
+
+// PatienceDiff returns a Differ writing unified diffs with context unchanged
+// lines around each change. The patience algorithm first lines up the lines
+// found only once in both got and want, which often keeps the diff of
+// reordered or repetitive output easier to read.
+func PatienceDiff(context int) Differ {
+	return unifiedDiffer{context: context, algorithm: diff.Patience}
+}
+
+// WithDiffer sets the Differ used for failures. Without it, the Differ is
+// picked with the IC_DIFF env var: "myers", "patience", or "side-by-side" with
+// an optional width such as "side-by-side:120". The default is MyersDiff(3).
+func WithDiffer(d Differ) Option {
+	return func(ic *IC) {
+		ic.differ = d
+	}
+}
+
+var defaultDiffer = MyersDiff(3)
+
+// defaultSideBySideWidth is the width of side by side diffs picked with
+// IC_DIFF without one
+const defaultSideBySideWidth = 160
+
+// differForStyle returns the Differ named by style, the value of IC_DIFF.
+// Styles it doesn't know get the default.
+func differForStyle(style string) Differ {
+	name, widthText, hasWidth := strings.Cut(strings.ToLower(style), ":")
+	switch name {
+	case "myers":
+		return MyersDiff(3)
+	case "patience":
+		return PatienceDiff(3)
+	case "side-by-side":
+		width := defaultSideBySideWidth
+		if parsed, err := strconv.Atoi(widthText); hasWidth && err == nil {
+			width = parsed
+		}
+		return SideBySideDiff(width, 3)
+	}
+	return defaultDiffer
+}
+
+type unifiedDiffer struct {
+	context   int
+	algorithm diff.Algorithm
+}
+
+func (u unifiedDiffer) Diff(got, want string) string {
+	return diff.Unified{
+		A:         diffLines(got),
+		B:         diffLines(want),
+		FromFile:  "Got",
+		ToFile:    "Want",
+		Context:   u.context,
+		Algorithm: u.algorithm,
+	}.String()
+}
+
+// diffLines splits s into lines that all end in a newline, so that a diff
+// doesn't turn on whether the output ended with one
+func diffLines(s string) []string {
+	return splitLines(s + "\n")
+}
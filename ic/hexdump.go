@@ -0,0 +1,100 @@
+package ic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// hexDumpWidth is the number of bytes on each line of a hex dump
+const hexDumpWidth = 16
+
+// PrintHexDump writes data to w in the format of xxd: each line holds the
+// offset of its first byte, up to 16 bytes in groups of two, and the bytes
+// again as ASCII with a "." for anything that isn't printable
+//
+//	00000000: 4865 6c6c 6f2c 2077 6f72 6c64 210a       Hello, world!.
+func PrintHexDump(w io.Writer, data []byte) error {
+	_, err := io.WriteString(w, hexDump(data))
+	return err
+}
+
+// hexDump returns the lines PrintHexDump writes for data
+func hexDump(data []byte) string {
+	var sb strings.Builder
+	for offset := 0; offset < len(data); offset += hexDumpWidth {
+		line := data[offset:]
+		if len(line) > hexDumpWidth {
+			line = line[:hexDumpWidth]
+		}
+		fmt.Fprintf(&sb, "%08x: ", offset)
+		for i := 0; i < hexDumpWidth; i++ {
+			if i > 0 && i%2 == 0 {
+				sb.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&sb, "%02x", line[i])
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("  ")
+		for _, b := range line {
+			if b >= 0x20 && b < 0x7f {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// parseHexDump reads the bytes back out of a dump written by PrintHexDump.
+// The ASCII column is ignored.
+func parseHexDump(dump string) ([]byte, error) {
+	var data []byte
+	for i, line := range strings.Split(strings.TrimSuffix(dump, "\n"), "\n") {
+		offsetText, rest, found := strings.Cut(line, ": ")
+		if !found {
+			return nil, fmt.Errorf("line %d of the hex dump has no offset", i+1)
+		}
+		offset, err := strconv.ParseInt(offsetText, 16, 64)
+		if err != nil || int(offset) != len(data) {
+			return nil, fmt.Errorf("line %d of the hex dump starts at offset %q, want %08x", i+1, offsetText, len(data))
+		}
+		hexText, _, _ := strings.Cut(rest, "  ")
+		lineData, err := hex.DecodeString(strings.ReplaceAll(hexText, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("line %d of the hex dump: %w", i+1, err)
+		}
+		data = append(data, lineData...)
+	}
+	return data, nil
+}
+
+// describeByteDiff reports where got first differs from want. It returns ""
+// when they are the same.
+func describeByteDiff(got, want []byte) string {
+	offset := 0
+	for offset < len(got) && offset < len(want) && got[offset] == want[offset] {
+		offset++
+	}
+	if offset == len(got) && offset == len(want) {
+		return ""
+	}
+	byteAt := func(data []byte) string {
+		if offset < len(data) {
+			return fmt.Sprintf("0x%02x", data[offset])
+		}
+		return "end of data"
+	}
+	description := fmt.Sprintf("first difference at offset 0x%08x (%d): got %s, want %s", offset, offset, byteAt(got), byteAt(want))
+	if len(got) != len(want) {
+		description += fmt.Sprintf(". got %d bytes, want %d", len(got), len(want))
+	}
+	return description
+}
@@ -0,0 +1,64 @@
+package ic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintHexDump(t *testing.T) {
+	var sb strings.Builder
+	data := []byte("0123456789abcdef\x00\t\n~\x7f")
+	if err := PrintHexDump(&sb, data); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef
+00000010: 0009 0a7e 7f                             ...~.
+`[1:]
+	assertEqual(t, sb.String(), want)
+
+	parsed, err := parseHexDump(sb.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed, data) {
+		t.Errorf("got %q, want %q", parsed, data)
+	}
+}
+
+func Test_parseHexDump_errorCases(t *testing.T) {
+	tests := []struct {
+		name, dump, wantErr string
+	}{
+		{"no offset", "3031", "line 1 of the hex dump has no offset"},
+		{"wrong offset", "00000010: 3031  01", `line 1 of the hex dump starts at offset "00000010", want 00000000`},
+		{"bad hex", "00000000: 30zz  0?", "line 1 of the hex dump: encoding/hex: invalid byte: U+007A 'z'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseHexDump(tt.dump)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_describeByteDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want []byte
+		wantDiff  string
+	}{
+		{"same", []byte("abc"), []byte("abc"), ""},
+		{"changed byte", []byte("abc"), []byte("abd"), "first difference at offset 0x00000002 (2): got 0x63, want 0x64"},
+		{"shorter", []byte("ab"), []byte("abc"), "first difference at offset 0x00000002 (2): got end of data, want 0x63. got 2 bytes, want 3"},
+		{"longer", []byte("abc"), nil, "first difference at offset 0x00000000 (0): got 0x61, want end of data. got 3 bytes, want 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, describeByteDiff(tt.got, tt.want), tt.wantDiff)
+		})
+	}
+}
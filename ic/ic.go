@@ -2,25 +2,34 @@ package ic
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
-	"sync/atomic"
 	"testing"
 
 	"github.com/BestFriendChris/go-ic/ic/internal/infra/cmd"
-	"github.com/pmezard/go-difflib/difflib"
 )
 
-func New(t testing.TB) *IC {
-	return &IC{t: t, testFileUpdater: NewTestFileUpdater()}
+func New(t testing.TB, opts ...Option) *IC {
+	ic := &IC{t: t, testFileUpdater: NewTestFileUpdater()}
+	for _, opt := range opts {
+		opt(ic)
+	}
+	return ic
 }
 
-func NewNullable(testFiles *map[string]string) (IC, *NullTester, *atomic.Bool, *cmd.OverridableFlagChecker) {
+func NewNullable(testFiles *map[string]string, opts ...Option) (IC, *NullTester, *cmd.OverridableFlagChecker) {
 	nt := NewNullTester()
-	tfu, underlyingBool, ofc := NewNullableTestFileUpdater(testFiles)
-	return IC{t: nt, testFileUpdater: tfu}, nt, underlyingBool, ofc
+	tfu, ofc := NewNullableTestFileUpdater(testFiles)
+	ic := IC{t: nt, testFileUpdater: tfu}
+	for _, opt := range opts {
+		opt(&ic)
+	}
+	return ic, nt, ofc
 }
 
 // IC is the test value runner. Create with New(*testing.TB)
@@ -29,6 +38,22 @@ type IC struct {
 	Writer          bytes.Buffer
 	replacements    []replacement
 	testFileUpdater TestFileUpdater
+	callerSkip      int
+	differ          Differ
+}
+
+// Option configures an IC. Pass options to New
+type Option func(*IC)
+
+// WithCallerSkip tells the updater to look for the expectation literal skip
+// callers above the function that called Expect. This is only needed for
+// wrappers around Expect that can't be followed automatically: string
+// parameters passed straight through to Expect are followed on their own, as
+// are helpers marked with t.Helper() that take the literal as an argument.
+func WithCallerSkip(skip int) Option {
+	return func(ic *IC) {
+		ic.callerSkip = skip
+	}
 }
 
 func (ic *IC) Print(output ...any) {
@@ -61,8 +86,21 @@ func (ic *IC) Printf(format string, a ...any) {
 //   - "IC_UPDATE" environment variable
 //   - "-test.icupdate" command line flag is set
 //
+// Setting either to "all" (IC_UPDATE=all or -test.icupdate=all) will also
+// replace any non-empty "want" that does not match. Setting either to
+// "patch:<file>" makes the same updates, but writes them to <file> as a unified
+// diff instead of changing the test files, and setting either to "pending"
+// stores them as pending snapshots to be reviewed with the ic command.
+//
+// Parts of the output that change from run to run can be left out of "want"
+// with placeholders: "[..]" matches any run of characters within a line, and
+// a line holding only "..." matches any number of lines. Rewriting "want"
+// keeps the placeholders that still match.
+//
 // Expect will fail the test immediately on failure. ExpectAndContinue can be
-// used to keep running the rest of the test
+// used to keep running the rest of the test. When the expectation is updated
+// instead, the test is failed but keeps running, so a single run updates
+// every expectation in it.
 func (ic *IC) Expect(want string) {
 	ic.t.Helper()
 	if !ic.expectAndLog(want) {
@@ -79,46 +117,298 @@ func (ic *IC) ExpectAndContinue(want string) {
 	}
 }
 
-func (ic *IC) expectAndLog(want string) (isSame bool) {
+// ExpectFile is Expect for output too large to keep in the test. The output
+// is compared to the contents of the golden file at path, which is relative
+// to the package directory, such as "testdata/report.golden". Updates work
+// the same way as for Expect, with a missing file standing in for an empty
+// expectation.
+func (ic *IC) ExpectFile(path string) {
 	ic.t.Helper()
+	if !ic.expectFileAndLog(path) {
+		ic.t.FailNow()
+	}
+}
+
+// ExpectBytes is Expect for binary data. data is compared to want as a hex
+// dump in the format of PrintHexDump, so that it can be recorded in the test
+// the same way. When they differ, the offset of the first byte that doesn't
+// match is logged along with the diff of the dumps.
+func (ic *IC) ExpectBytes(data []byte, want string) {
+	ic.t.Helper()
+	if !ic.expectBytesAndLog(data, want) {
+		ic.t.FailNow()
+	}
+}
+
+// ExpectUnordered is Expect for output whose lines come in no set order, such
+// as output written from several goroutines. The lines are compared as a
+// multiset, and a failure lists the lines that are missing and unexpected
+// rather than a diff. Replacements apply as they do for Expect. Rewriting
+// "want" keeps its order for the lines that are still there, adding new
+// lines at the end.
+func (ic *IC) ExpectUnordered(want string) {
+	ic.t.Helper()
+	if !ic.expectUnorderedAndLog(want) {
+		ic.t.FailNow()
+	}
+}
+
+// ExpectJSON is Expect for output that is a JSON value. The output and want
+// are both parsed and compared as JSON, so the order of object keys, spacing
+// and the way numbers are written don't matter. On a mismatch the diff is of
+// both in a canonical form, indented with sorted keys, and that form is what
+// gets recorded when "want" is rewritten.
+func (ic *IC) ExpectJSON(want string) {
+	ic.t.Helper()
+	if !ic.expectJSONAndLog(want) {
+		ic.t.FailNow()
+	}
+}
+
+// output returns everything printed since the last expectation, with the
+// replacements applied, and starts collecting output afresh
+func (ic *IC) output() string {
 	got := trim(ic.Writer.String())
 	for _, rp := range ic.replacements {
 		got = rp.replace(got)
 	}
-	isSame = ic.logDiffIfDifferent(want, got)
 	ic.Writer.Truncate(0)
+	return got
+}
+
+func (ic *IC) expectAndLog(want string) (ok bool) {
+	ic.t.Helper()
+	got := applyPlaceholders(trim(want), ic.output())
+	isSame := ic.logDiffIfDifferent(want, got)
+	return ic.updateIfNeeded(want, got, isSame)
+}
+
+func (ic *IC) expectBytesAndLog(data []byte, want string) (ok bool) {
+	ic.t.Helper()
+	got := strings.TrimSuffix(hexDump(data), "\n")
+	isSame := ic.logDiffIfDifferent(want, got)
+	if !isSame && len(want) != 0 {
+		if wantData, err := parseHexDump(trim(want)); err != nil {
+			ic.t.Logf("IC: unable to compare bytes: %s", err)
+		} else if diff := describeByteDiff(data, wantData); diff != "" {
+			ic.t.Logf("IC: %s", diff)
+		}
+	}
+	return ic.updateIfNeeded(want, got, isSame)
+}
+
+func (ic *IC) expectUnorderedAndLog(want string) (ok bool) {
+	ic.t.Helper()
+	got := ic.output()
+	missing, unexpected := compareUnordered(outputLines(trim(want)), outputLines(got))
+	isSame := len(missing) == 0 && len(unexpected) == 0
+	if !isSame {
+		ic.t.Logf("\n%s", describeUnordered(missing, unexpected))
+		if len(want) != 0 {
+			got = orderLike(trim(want), got)
+		}
+	}
+	return ic.updateIfNeeded(want, got, isSame)
+}
+
+func (ic *IC) expectJSONAndLog(want string) (ok bool) {
+	ic.t.Helper()
+	got, err := canonicalJSON(ic.output())
+	if err != nil {
+		ic.t.Logf("IC: output is not valid JSON: %s", err)
+		return false
+	}
+	var canonicalWant string
+	if len(want) != 0 {
+		canonicalWant, err = canonicalJSON(want)
+		if err != nil {
+			ic.t.Logf("IC: expectation is not valid JSON: %s", err)
+		}
+	}
+	diff := formatDiff(ic.lineDiffer(), canonicalWant, got, true)
+	if err == nil && diff != "" {
+		ic.logDiff(diff)
+	}
+	return ic.updateIfNeeded(want, got, err == nil && diff == "")
+}
+
+// updateIfNeeded updates the expectation want with got when the update mode
+// calls for it. It returns false when the test should stop, because the
+// expectation failed and wasn't updated.
+func (ic *IC) updateIfNeeded(want, got string, isSame bool) bool {
+	ic.t.Helper()
+	mode := ic.testFileUpdater.UpdateMode()
+	update := func() {
+		ic.t.Helper()
+		ic.testFileUpdater.Update(ic, want, got)
+	}
 	if len(want) == 0 {
-		if ic.testFileUpdater.UpdateEnabled() {
-			ic.testFileUpdater.Update(ic, got)
-			return false
+		if mode.Updates() {
+			return ic.queueUpdate(update)
 		} else {
 			ic.t.Log(`IC: update is disabled. enable with "-test.icupdate" flag or set the IC_UPDATE env var to anything`)
 		}
+	} else if !isSame && mode.RewritesMismatches() {
+		return ic.queueUpdate(update)
+	} else if isSame && mode == cmd.UpdatePending {
+		ic.testFileUpdater.ClearPending(ic)
 	}
-	return
+	return isSame
 }
 
-func (ic *IC) logDiffIfDifferent(want string, got string) (isSame bool) {
+// queueUpdate makes an update and marks the test failed, so that it is rerun
+// to verify it. It returns true so the test goes on, letting a single run
+// record every expectation in the test.
+func (ic *IC) queueUpdate(update func()) bool {
 	ic.t.Helper()
-	trimmedWant := trim(want)
-	isSame = got == trimmedWant
-	if !isSame {
-		if isMultiline(want) || isMultiline(got) {
-			diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-				A:        difflib.SplitLines(got),
-				B:        difflib.SplitLines(trimmedWant),
-				FromFile: "Got",
-				FromDate: "",
-				ToFile:   "Want",
-				ToDate:   "",
-				Context:  3,
-			})
-			ic.t.Logf("\n%s", diff)
-		} else {
-			ic.t.Logf("\n got: %q\nwant: %q", got, trimmedWant)
+	update()
+	ic.t.Fail()
+	return true
+}
+
+// Snapshot is Expect for output stored away from the test, in a snapshot
+// document for the test file at testdata/__snapshots__/<file>.snap. Snapshots
+// are keyed by the name of the running test along with name, so a test can
+// have several. Updates work the same way as for Expect, with a missing
+// snapshot standing in for an empty expectation.
+func (ic *IC) Snapshot(name string) {
+	ic.t.Helper()
+	if !ic.snapshotAndLog(name) {
+		ic.t.FailNow()
+	}
+}
+
+func (ic *IC) expectFileAndLog(path string) (ok bool) {
+	ic.t.Helper()
+	got := ic.output()
+	want, err := ic.testFileUpdater.readGolden(path)
+	exists := !errors.Is(err, fs.ErrNotExist)
+	if err != nil && exists {
+		ic.t.Logf("IC: error reading golden file %s: %s", path, err)
+		return false
+	}
+	return ic.expectStoredAndLog("golden file "+path, string(want), exists, got, func() {
+		ic.t.Helper()
+		ic.testFileUpdater.UpdateGolden(ic, path, want, got)
+	})
+}
+
+func (ic *IC) snapshotAndLog(name string) (ok bool) {
+	ic.t.Helper()
+	got := ic.output()
+	docPath, err := snapshotDocPath()
+	if err != nil {
+		ic.t.Logf("IC: %s", err)
+		return false
+	}
+	key, err := snapshotKey(ic.t.Name(), name)
+	if err != nil {
+		ic.t.Logf("IC: %s", err)
+		return false
+	}
+	want, exists, err := ic.testFileUpdater.readSnapshot(docPath, key)
+	if err != nil {
+		ic.t.Logf("IC: error reading snapshots from %s: %s", docPath, err)
+		return false
+	}
+	return ic.expectStoredAndLog(fmt.Sprintf("snapshot %q in %s", key, docPath), want, exists, got, func() {
+		ic.t.Helper()
+		ic.testFileUpdater.UpdateSnapshot(ic, docPath, key, got)
+	})
+}
+
+// expectStoredAndLog compares got with an expectation stored outside of the
+// test, described by what, calling update when it should be rewritten. Like
+// updateIfNeeded, it returns false when the test should stop.
+func (ic *IC) expectStoredAndLog(what string, want string, exists bool, got string, update func()) (ok bool) {
+	ic.t.Helper()
+	mode := ic.testFileUpdater.UpdateMode()
+	if !exists {
+		if mode.Updates() {
+			return ic.queueUpdate(update)
+		}
+		ic.t.Logf(`IC: %s does not exist. enable update with "-test.icupdate" flag or set the IC_UPDATE env var to anything`, what)
+		return false
+	}
+
+	diff := formatDiff(ic.lineDiffer(), want, got, false)
+	if diff != "" {
+		ic.logDiff(diff)
+		if mode.RewritesMismatches() {
+			return ic.queueUpdate(update)
 		}
 	}
-	return
+	return diff == ""
+}
+
+func (ic *IC) logDiffIfDifferent(want string, got string) (isSame bool) {
+	ic.t.Helper()
+	diff := formatDiff(ic.lineDiffer(), trim(want), got, isMultiline(want))
+	if diff != "" {
+		ic.logDiff(diff)
+	}
+	return diff == ""
+}
+
+// lineDiffer returns the Differ set with WithDiffer, or the one picked by
+// IC_DIFF
+func (ic *IC) lineDiffer() Differ {
+	if ic.differ != nil {
+		return ic.differ
+	}
+	return differForStyle(ic.testFileUpdater.DiffStyle())
+}
+
+// logDiff logs a diff made by formatDiff, in color when the terminal allows
+func (ic *IC) logDiff(diff string) {
+	ic.t.Helper()
+	if ic.testFileUpdater.UseColor() {
+		diff = colorDiff(diff)
+	}
+	ic.t.Logf("\n%s", diff)
+}
+
+// FormatDiff describes how got differs from the expectation want, in the
+// format Expect logs it. It returns "" when they match.
+func FormatDiff(want string, got string) string {
+	return formatDiff(defaultDiffer, trim(want), got, isMultiline(want))
+}
+
+// formatDiff is FormatDiff for an expectation that is used as is. Multiline
+// output is shown as a line diff, as is everything when asLines is set. The
+// characters that changed within a line are marked with carets.
+func formatDiff(differ Differ, trimmedWant string, got string, asLines bool) string {
+	if got == trimmedWant {
+		return ""
+	}
+	if asLines || isMultiline(trimmedWant) || isMultiline(got) {
+		return highlightUnifiedDiff(differ.Diff(got, trimmedWant))
+	}
+	quotedGot, quotedWant := strconv.Quote(got), strconv.Quote(trimmedWant)
+	gotMarks, wantMarks, _ := highlightChanges(quotedGot, quotedWant)
+	// A side with nothing marked, such as text that was only added to on
+	// the other side, gets no line of carets
+	var sb strings.Builder
+	sb.WriteString(" got: " + quotedGot)
+	if gotMarks != "" {
+		sb.WriteString("\n      " + gotMarks)
+	}
+	sb.WriteString("\nwant: " + quotedWant)
+	if wantMarks != "" {
+		sb.WriteString("\n      " + wantMarks)
+	}
+	return sb.String()
+}
+
+// PrintHexDump prints data as a hex dump, in the format of xxd. See the
+// PrintHexDump function for details.
+func (ic *IC) PrintHexDump(data []byte) {
+	ic.t.Helper()
+	err := PrintHexDump(&ic.Writer, data)
+	if err != nil {
+		ic.t.Logf("PrintHexDump: %s", err)
+		ic.t.FailNow()
+	}
 }
 
 // TT is a test table struct for PrintTable or PrintVals
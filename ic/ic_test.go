@@ -2,10 +2,12 @@ package ic_test
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"testing"
 	"time"
 
@@ -53,7 +55,7 @@ func TestIC_Expect_clearOutputAfterExpect(t *testing.T) {
 }
 
 func TestIC_Expect_fail(t *testing.T) {
-	c, nt, _, _ := newNullable()
+	c, nt, _ := newNullable()
 	c.Print("this will succeed")
 	c.Expect("this will fail")
 
@@ -78,7 +80,7 @@ want: "this will fail"`
 }
 
 func TestIC_ExpectAndContinue_fail(t *testing.T) {
-	c, nt, _, _ := newNullable()
+	c, nt, _ := newNullable()
 	c.Print("this will succeed")
 	c.ExpectAndContinue("this will fail")
 
@@ -103,8 +105,23 @@ want: "this will fail"`
 	}
 }
 
+func TestIC_Expect_failWithEmptyExpectation(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.Print("x")
+	c.ExpectAndContinue(``)
+
+	// Nothing in want changed, so it gets no line of carets
+	want := "\n got: \"x\"\n       ^\nwant: \"\""
+	if len(nt.Output) != 2 {
+		t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
+	}
+	if got := nt.Output[0]; got != want {
+		t.Errorf("\n got: %q\nwant: %q", got, want)
+	}
+}
+
 func TestIC_Expect_failWithMultipleLines(t *testing.T) {
-	c, nt, _, _ := newNullable()
+	c, nt, _ := newNullable()
 	c.Println("this will")
 	c.Println("succeed")
 	c.Expect(`
@@ -134,8 +151,364 @@ func TestIC_Expect_failWithMultipleLines(t *testing.T) {
 	}
 }
 
+func TestIC_Expect_failWithSimilarLines(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.PrintTable([]ic.TT[float64]{{"third", 1.0 / 3, 0.333}})
+	c.Expect(`
+			   | Name    | Have               | Want  |
+			---+---------+--------------------+-------+
+			 1 | "third" | 0.3333333333333334 | 0.333 |
+			---+---------+--------------------+-------+
+			`)
+
+	want := `
+--- Got
++++ Want
+@@ -1,5 +1,5 @@
+    | Name    | Have               | Want  |
+ ---+---------+--------------------+-------+
+- 1 | "third" | 0.3333333333333333 | 0.333 |
+?                                ^
++ 1 | "third" | 0.3333333333333334 | 0.333 |
+?                                ^
+ ---+---------+--------------------+-------+
+ 
+`
+	if len(nt.Output) != 1 {
+		t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+	}
+	got := nt.Output[0]
+	if got != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestIC_Expect_failInColor(t *testing.T) {
+	c, nt, ofc := newNullable()
+	ofc.ColorEnabled = true
+	ofc.ColorValue = "always"
+
+	c.Print("value: 1.234")
+	c.ExpectAndContinue("value: 1.235")
+	c.Println("same")
+	c.Println("changed")
+	c.ExpectAndContinue(`
+			same
+			different
+			`)
+
+	want := []string{
+		"\n\x1b[31m got: \"value: 1.23\x1b[7m4\x1b[27m\"\x1b[0m\n" +
+			"\x1b[32mwant: \"value: 1.23\x1b[7m5\x1b[27m\"\x1b[0m",
+		"\n\x1b[1m--- Got\x1b[0m\n" +
+			"\x1b[1m+++ Want\x1b[0m\n" +
+			"\x1b[36m@@ -1,3 +1,3 @@\x1b[0m\n" +
+			" same\n" +
+			"\x1b[31m-changed\x1b[0m\n" +
+			"\x1b[32m+different\x1b[0m\n" +
+			" \n",
+	}
+	if !reflect.DeepEqual(nt.Output, want) {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", nt.Output, want)
+	}
+}
+
+func TestIC_Expect_withPlaceholders(t *testing.T) {
+	c := ic.New(t)
+	c.Printf("started at %s\n", time.Now().Format(time.RFC3339))
+	for i := 0; i < 3; i++ {
+		c.Printf("worker %d ready\n", i)
+	}
+	c.Println("done")
+	c.Expect(`
+		started at [..]
+		...
+		done
+		`)
+}
+
+func TestIC_Expect_failWithPlaceholders(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.Println("took 12ms")
+	c.Println("id: 1")
+	c.Println("id: 2")
+	c.Println("status: failed")
+	c.ExpectAndContinue(`
+		took [..]ms
+		...
+		status: ok
+		`)
+
+	want := `
+--- Got
++++ Want
+@@ -1,4 +1,4 @@
+ took [..]ms
+ ...
+-status: failed
++status: ok
+ 
+`
+	if len(nt.Output) != 1 {
+		t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+	}
+	if got := nt.Output[0]; got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestIC_Expect_whenMismatched_updateAllKeepsPlaceholders(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "all"
+
+	c.Println("took 12ms")
+	c.Println("new value")
+	c.Expect(`
+		took [..]ms
+		old value
+		`)
+
+	wantLiteral := "c.Expect(`\n\t\ttook [..]ms\n\t\tnew value\n\t\t`)"
+	if !strings.Contains(fakeFs[testFile], wantLiteral) {
+		t.Errorf("expected the test file to contain %q", wantLiteral)
+	}
+}
+
+func TestIC_ExpectUnordered(t *testing.T) {
+	c := ic.New(t)
+	c.Replace(`took \d+`, "took N")
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			c.Printf("worker %d took %d\n", i, 10*i)
+		}(i)
+	}
+	wg.Wait()
+	c.ExpectUnordered(`
+		worker 0 took N
+		worker 1 took N
+		worker 2 took N
+		`)
+}
+
+func TestIC_ExpectUnordered_fail(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.Println("b")
+	c.Println("a")
+	c.Println("a")
+	c.Println("d")
+	c.ExpectUnordered(`
+		a
+		b
+		c
+		`)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	want := `
+lines differ, ignoring order
+missing from got:
+  "c"
+unexpected in got:
+  "a"
+  "d"`
+	if len(nt.Output) != 1 {
+		t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+	}
+	if got := nt.Output[0]; got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestIC_ExpectUnordered_whenMismatched_updateAll(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "all"
+
+	c.Println("new")
+	c.Println("b")
+	c.Println("a")
+	c.ExpectUnordered(`
+		a
+		old
+		b
+		`)
+
+	wantLiteral := "c.ExpectUnordered(`\n\t\ta\n\t\tb\n\t\tnew\n\t\t`)"
+	if !strings.Contains(fakeFs[testFile], wantLiteral) {
+		t.Errorf("expected the test file to contain %q", wantLiteral)
+	}
+}
+
+func TestIC_ExpectJSON(t *testing.T) {
+	c := ic.New(t)
+	c.Print(`{"name":"ic","version":1.0,"tags":["go","test"]}`)
+	c.ExpectJSON(`
+		{
+			"tags": ["go", "test"],
+			"version": 1,
+			"name": "ic"
+		}
+		`)
+}
+
+func TestIC_ExpectJSON_fail(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.Print(`{"name":"ic","version":2}`)
+	c.ExpectJSON(`{"version": 1, "name": "ic"}`)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	want := `
+--- Got
++++ Want
+@@ -1,5 +1,5 @@
+ {
+   "name": "ic",
+-  "version": 2
+?             ^
++  "version": 1
+?             ^
+ }
+ 
+`
+	if len(nt.Output) != 1 {
+		t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+	}
+	if got := nt.Output[0]; got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestIC_ExpectJSON_failWithInvalidOutput(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.Print(`{"name":`)
+	c.ExpectJSON(`{"name": "ic"}`)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+	want := []string{"IC: output is not valid JSON: unexpected EOF"}
+	if !reflect.DeepEqual(nt.Output, want) {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", nt.Output, want)
+	}
+}
+
+func TestIC_ExpectJSON_whenMismatched_updateAll(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "all"
+
+	c.Print(`{"b":2.0,"a":1}`)
+	c.ExpectJSON(`{"a": 1}`)
+
+	wantLiteral := "c.ExpectJSON(`\n\t\t{\n\t\t  \"a\": 1,\n\t\t  \"b\": 2\n\t\t}\n\t\t`)"
+	if !strings.Contains(fakeFs[testFile], wantLiteral) {
+		t.Errorf("expected the test file to contain %q", wantLiteral)
+	}
+}
+
+func TestIC_WithDiffer(t *testing.T) {
+	t.Run("context", func(t *testing.T) {
+		fakeFs := makeFakeFs()
+		c, nt, _ := ic.NewNullable(&fakeFs, ic.WithDiffer(ic.PatienceDiff(1)))
+		c.Println("a\nb\nc\nd")
+		c.ExpectAndContinue(`
+				a
+				b
+				C
+				d
+				`)
+
+		want := []string{"\n--- Got\n+++ Want\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n"}
+		if !reflect.DeepEqual(nt.Output, want) {
+			t.Errorf("\ngot:\n%q\nwant:\n%q", nt.Output, want)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		fakeFs := makeFakeFs()
+		c, nt, _ := ic.NewNullable(&fakeFs, ic.WithDiffer(lineCountDiffer{}))
+		c.Println("a\nb")
+		c.ExpectAndContinue(`
+				a
+				`)
+
+		want := []string{"\ngot 2 lines, want 1"}
+		if !reflect.DeepEqual(nt.Output, want) {
+			t.Errorf("\ngot:\n%q\nwant:\n%q", nt.Output, want)
+		}
+	})
+}
+
+func TestIC_SideBySideDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ic.Option
+		env  string
+	}{
+		{"option", []ic.Option{ic.WithDiffer(ic.SideBySideDiff(100, 3))}, ""},
+		{"env", nil, "side-by-side:100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeFs := makeFakeFs()
+			c, nt, ofc := ic.NewNullable(&fakeFs, tt.opts...)
+			ofc.DiffValue = tt.env
+			c.PrintTable([]ic.TT[float64]{{"third", 1.0 / 3, 0.333}, {"half", 0.5, 0.5}})
+			c.ExpectAndContinue(`
+				   | Name    | Have               | Want  |
+				---+---------+--------------------+-------+
+				 1 | "third" | 0.3333333333333334 | 0.333 |
+				---+---------+--------------------+-------+
+				 2 | "half"  | 0.5                | 0.5   |
+				---+---------+--------------------+-------+
+				`)
+
+			want := `
+Got line 1                                         Want line 1
+   | Name    | Have               | Want  |           | Name    | Have               | Want  |
+---+---------+--------------------+-------+        ---+---------+--------------------+-------+
+ 1 | "third" | 0.3333333333333333 | 0.333 |      |  1 | "third" | 0.3333333333333334 | 0.333 |
+---+---------+--------------------+-------+        ---+---------+--------------------+-------+
+ 2 | "half"  | 0.5                | 0.5   |         2 | "half"  | 0.5                | 0.5   |
+---+---------+--------------------+-------+        ---+---------+--------------------+-------+
+`
+			if len(nt.Output) != 1 {
+				t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+			}
+			if got := nt.Output[0]; got != want {
+				t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+			}
+		})
+	}
+}
+
+type lineCountDiffer struct{}
+
+func (lineCountDiffer) Diff(got, want string) string {
+	return fmt.Sprintf("got %d lines, want %d", strings.Count(got, "\n"), strings.Count(want, "\n"))
+}
+
 func TestIC_Expect_whenEmptyLines_updateEnabled(t *testing.T) {
-	c, nt, _, ofc := newNullable()
+	c, nt, ofc := newNullable()
 	ofc.FlagEnabled = true
 
 	c.Println("this will fail")
@@ -157,7 +530,7 @@ func TestIC_Expect_whenEmptyLines_updateEnabled(t *testing.T) {
 }
 
 func TestIC_Expect_whenEmptyLines_updateDisabled(t *testing.T) {
-	c, nt, _, ofc := newNullable()
+	c, nt, ofc := newNullable()
 	ofc.FlagEnabled = false
 	ofc.EnvEnabled = false
 
@@ -181,21 +554,80 @@ func TestIC_Expect_whenEmptyLines_updateDisabled(t *testing.T) {
 }
 
 func TestIC_Expect_whenEmptyLines_updatingTwice(t *testing.T) {
-	c, nt, alreadySeen, ofc := newNullable()
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
 	ofc.FlagEnabled = true
 
-	if alreadySeen.Load() != false {
-		t.Error("should have started not already seen")
+	c.Println("first update")
+	c.ExpectAndContinue(``)
+
+	c.Println("second update")
+	c.ExpectAndContinue(``)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	want := `IC: Updating test file. Rerun tests to verify
+`
+	if len(nt.Output) != 4 {
+		t.Fatalf("got %d elements, want 4 elements in:\n%#v", len(nt.Output), nt.Output)
+	}
+	for _, got := range []string{nt.Output[1], nt.Output[3]} {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("\n got: %q\nwant: %q", got, want)
+		}
 	}
 
-	c.Println("this will fail and update")
+	for _, updated := range fakeFs {
+		for _, wantCall := range []string{"c.ExpectAndContinue(`first update`)", "c.ExpectAndContinue(`second update`)"} {
+			if !strings.Contains(updated, wantCall) {
+				t.Errorf("expected test file to contain %s", wantCall)
+			}
+		}
+	}
+}
+
+func TestIC_Expect_whenEmptyLines_updatingTwiceWithExpect(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	ofc.FlagEnabled = true
+
+	c.Println("first expect")
+	c.Expect(``)
+
+	c.Println("second expect")
 	c.Expect(``)
 
-	if alreadySeen.Load() != true {
-		t.Error("now should have been already seen")
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+	if nt.Exited {
+		t.Error("Expected the test to go on after queueing an update")
+	}
+	for _, wantCall := range []string{"c.Expect(`first expect`)", "c.Expect(`second expect`)"} {
+		if !strings.Contains(fakeFs[testFile], wantCall) {
+			t.Errorf("expected test file to contain %s", wantCall)
+		}
+	}
+}
+
+func TestIC_Expect_whenEmptyLines_updatingSameExpectationTwice(t *testing.T) {
+	c, nt, ofc := newNullable()
+	ofc.FlagEnabled = true
+
+	for _, output := range []string{"first", "second"} {
+		nt.Reset()
+		c.Println(output)
+		c.Expect(``)
 	}
 
-	want := `IC: Updating test file. Rerun tests to verify
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	want := `IC: expectation already updated during this run. Skipping update. Rerun tests to try again
 `
 	if len(nt.Output) != 2 {
 		t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
@@ -204,26 +636,434 @@ func TestIC_Expect_whenEmptyLines_updatingTwice(t *testing.T) {
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("\n got: %q\nwant: %q", got, want)
 	}
+}
 
-	nt.Reset()
-	c.Println("this will fail as well but not update")
-	c.Expect(``)
+func TestIC_Expect_whenEmptyLines_updatingThroughHelper(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	ofc.FlagEnabled = true
+
+	c.Println("updated through helper")
+	expectThroughHelper(&c, ``)
+
+	if len(nt.Output) != 2 {
+		t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
+	}
+
+	for _, updated := range fakeFs {
+		wantCall := "expectThroughHelper(&c, `updated through helper`)"
+		if !strings.Contains(updated, wantCall) {
+			t.Errorf("expected test file to contain %s", wantCall)
+		}
+	}
+}
+
+func expectThroughHelper(c *ic.IC, want string) {
+	c.Expect(want)
+}
+
+func TestIC_Expect_whenMismatched_updateAll(t *testing.T) {
+	c, nt, ofc := newNullable()
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "all"
+
+	c.Println("new value")
+	c.Expect(`old value`)
 
 	if !nt.Failed {
 		t.Error("Expected this to fail")
 	}
 
-	want = `IC: already updated a test file. Skipping update. Rerun tests to try again
+	want := `IC: Updating test file. Rerun tests to verify
 `
 	if len(nt.Output) != 2 {
 		t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
 	}
-	got = nt.Output[1]
+	got := nt.Output[1]
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("\n got: %q\nwant: %q", got, want)
 	}
 }
 
+func TestIC_Expect_whenMismatched_updateEmptyOnly(t *testing.T) {
+	c, nt, ofc := newNullable()
+	ofc.EnvEnabled = true
+
+	c.Println("new value")
+	c.Expect(`old value`)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	if len(nt.Output) != 1 {
+		t.Fatalf("got %d elements, want 1 element in:\n%#v", len(nt.Output), nt.Output)
+	}
+}
+
+func TestIC_Expect_whenMismatched_updatePatch(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	original := fakeFs[testFile]
+	patchPath := filepath.Join(filepath.Dir(testFile), "ic.diff")
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:" + patchPath
+
+	c.Print("patched value")
+	c.Expect(`old value`)
+
+	want := "IC: Recorded update in patch " + patchPath
+	if len(nt.Output) != 2 {
+		t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
+	}
+	if got := nt.Output[1]; got != want {
+		t.Errorf("\n got: %q\nwant: %q", got, want)
+	}
+
+	if fakeFs[testFile] != original {
+		t.Error("expected the test file to be left alone")
+	}
+	patch := fakeFs[patchPath]
+	for _, wantLine := range []string{
+		"diff --git a/ic_test.go b/ic_test.go\n",
+		"\n-\tc.Expect(`old value`)\n",
+		"\n+\tc.Expect(`patched value`)\n",
+	} {
+		if !strings.Contains(patch, wantLine) {
+			t.Errorf("expected patch to contain %q in:\n%s", wantLine, patch)
+		}
+	}
+}
+
+func TestIC_Expect_whenMismatched_updateNestedPatch(t *testing.T) {
+	fakeFs := makeFakeFs()
+	_, testFile, _, _ := runtime.Caller(0)
+	root := filepath.Dir(filepath.Dir(testFile))
+	fakeFs[filepath.Join(root, ".git", "HEAD")] = ""
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:path/to/out.diff"
+
+	c.Print("patched value")
+	c.Expect(`old value`)
+
+	// The patch applies from the root, however deep it is written
+	patch := fakeFs[filepath.Join(root, "path", "to", "out.diff")]
+	for _, wantLine := range []string{
+		"diff --git a/ic/ic_test.go b/ic/ic_test.go\n",
+		"--- a/ic/ic_test.go\n",
+		"+++ b/ic/ic_test.go\n",
+	} {
+		if !strings.Contains(patch, wantLine) {
+			t.Errorf("expected patch to contain %q in:\n%s", wantLine, patch)
+		}
+	}
+}
+
+func TestIC_Expect_whenSourceChangedSinceBuild(t *testing.T) {
+	fakeFs := makeFakeFs()
+	_, testFile, _, _ := runtime.Caller(0)
+	// Someone adds lines to the top of the test file while the tests run, so
+	// the line numbers in this test binary now point at the wrong Expect
+	fakeFs[testFile] = strings.Replace(fakeFs[testFile], "package ic_test\n", "package ic_test\n\n\n", 1)
+	changed := fakeFs[testFile]
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "all"
+
+	c.Print("first")
+	c.ExpectAndContinue(`first`)
+	c.Print("second")
+	c.ExpectAndContinue(`old`)
+	_, _, line, _ := runtime.Caller(0)
+
+	if !nt.Failed {
+		t.Error("expected the update to fail")
+	}
+	want := fmt.Sprintf(`IC: unable to update test file: the expectation at %s:%d is "first", but the running test expected "old". `, testFile, line-1) +
+		"The file has changed since the test was built. Rerun the tests to update it"
+	if got := nt.Output[len(nt.Output)-1]; got != want {
+		t.Errorf("\n got: %q\nwant: %q", got, want)
+	}
+	if fakeFs[testFile] != changed {
+		t.Error("expected the test file to be left alone")
+	}
+}
+
+func TestIC_Expect_whenMismatched_updatePending(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	_, testFile, _, _ := runtime.Caller(0)
+	original := fakeFs[testFile]
+	pendingPath := filepath.Join(filepath.Dir(testFile), "testdata", ".ic-pending", "ic_test.go.ic.new")
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "pending"
+
+	for _, output := range []string{"new value", "old value"} {
+		nt.Reset()
+		c.Print(output)
+		c.ExpectAndContinue(`old value`)
+
+		if output == "new value" {
+			want := "IC: Recorded pending snapshot in " + pendingPath
+			if len(nt.Output) != 2 {
+				t.Fatalf("got %d elements, want 2 elements in:\n%#v", len(nt.Output), nt.Output)
+			}
+			if got := nt.Output[1]; got != want {
+				t.Errorf("\n got: %q\nwant: %q", got, want)
+			}
+			for _, wantField := range []string{`"file": "ic_test.go"`, `"old": "old value"`, `"new": "new value"`} {
+				if !strings.Contains(fakeFs[pendingPath], wantField) {
+					t.Errorf("expected pending snapshots to contain %s in:\n%s", wantField, fakeFs[pendingPath])
+				}
+			}
+		}
+	}
+
+	if nt.Failed {
+		t.Errorf("expected the final run to pass: %#v", nt.Output)
+	}
+	if _, found := fakeFs[pendingPath]; found {
+		t.Error("expected the pending snapshot to be removed once the test passed")
+	}
+	if fakeFs[testFile] != original {
+		t.Error("expected the test file to be left alone")
+	}
+}
+
+func TestIC_ExpectFile(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "report.golden")
+	fakeFs := map[string]string{goldenPath: "line 1\nline 2\n"}
+	c, nt, _ := ic.NewNullable(&fakeFs)
+
+	c.Println("line 1")
+	c.Println("line 2")
+	c.ExpectFile(goldenPath)
+
+	if nt.Failed {
+		t.Errorf("expected the golden file to match: %#v", nt.Output)
+	}
+}
+
+func TestIC_ExpectFile_fail(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "report.golden")
+	fakeFs := map[string]string{goldenPath: "line 1\nline 2\n"}
+	c, nt, _ := ic.NewNullable(&fakeFs)
+
+	c.Println("line 1")
+	c.Println("line two")
+	c.ExpectFile(goldenPath)
+
+	if !nt.Exited {
+		t.Error("expected ExpectFile to fail the test")
+	}
+	want := `
+--- Got
++++ Want
+@@ -1,3 +1,3 @@
+ line 1
+-line two
++line 2
+ 
+`
+	if len(nt.Output) != 1 || nt.Output[0] != want {
+		t.Errorf("\n got: %#v\nwant: %q", nt.Output, want)
+	}
+}
+
+func TestIC_ExpectFile_whenMissing(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "report.golden")
+	fakeFs := map[string]string{}
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+
+	c.Println("report")
+	c.ExpectFile(goldenPath)
+
+	want := `IC: golden file testdata/report.golden does not exist. enable update with "-test.icupdate" flag or set the IC_UPDATE env var to anything`
+	if !nt.Failed || len(nt.Output) != 1 || nt.Output[0] != want {
+		t.Errorf("\n got: %#v\nwant: %q", nt.Output, want)
+	}
+
+	nt.Reset()
+	ofc.EnvEnabled = true
+	c.Println("report")
+	c.ExpectFile(goldenPath)
+
+	want = "IC: Updating golden file testdata/report.golden. Rerun tests to verify"
+	if !nt.Failed || len(nt.Output) != 1 || nt.Output[0] != want {
+		t.Errorf("\n got: %#v\nwant: %q", nt.Output, want)
+	}
+	if got := fakeFs[goldenPath]; got != "report\n" {
+		t.Errorf("\n got: %q\nwant: %q", got, "report\n")
+	}
+}
+
+func TestIC_ExpectFile_whenMismatched_updateAll(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "report.golden")
+	fakeFs := map[string]string{goldenPath: "old report\n"}
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	ofc.EnvEnabled = true
+
+	// Like Expect, only missing files are written unless updating "all"
+	for _, mode := range []string{"true", "all"} {
+		nt.Reset()
+		ofc.EnvValue = mode
+		c.Replace(`\d+`, "<N>")
+		c.Printf("new report %d\n", 42)
+		c.ExpectFile(goldenPath)
+	}
+
+	if !nt.Failed {
+		t.Error("expected the update to fail the test")
+	}
+	if got, want := fakeFs[goldenPath], "new report <N>\n"; got != want {
+		t.Errorf("\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestIC_ExpectFile_whenMissing_updatePatch(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "report.golden")
+	wd, _ := os.Getwd()
+	fakeFs := map[string]string{filepath.Join(wd, ".git", "HEAD"): ""}
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	patchPath := filepath.Join(t.TempDir(), "ic.diff")
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:" + patchPath
+	ofc.RunIDValue = "42"
+
+	c.Println("report")
+	c.ExpectFile(goldenPath)
+
+	if _, found := fakeFs[goldenPath]; found {
+		t.Error("expected the golden file to be left alone")
+	}
+	relPath := "testdata/report.golden"
+	want := `Updates recorded by github.com/BestFriendChris/go-ic in run 42. Apply them with "git apply".
+` + "diff --git a/" + relPath + " b/" + relPath + `
+new file mode 100644
+--- /dev/null
++++ b/` + relPath + `
+@@ -0,0 +1 @@
++report
+`
+	if got := fakeFs[patchPath]; got != want {
+		t.Errorf("\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestIC_ExpectFile_updatePatch_replacesEarlierRun(t *testing.T) {
+	wd, _ := os.Getwd()
+	fakeFs := map[string]string{filepath.Join(wd, ".git", "HEAD"): ""}
+	c, _, ofc := ic.NewNullable(&fakeFs)
+	patchPath := filepath.Join(t.TempDir(), "ic.diff")
+	fakeFs[patchPath] = `Updates recorded by github.com/BestFriendChris/go-ic in run 41. Apply them with "git apply".
+diff --git a/testdata/stale.golden b/testdata/stale.golden
+new file mode 100644
+--- /dev/null
++++ b/testdata/stale.golden
+@@ -0,0 +1 @@
++stale
+`
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:" + patchPath
+	ofc.RunIDValue = "42"
+
+	// Updates from the same run are kept, but none from the run before
+	c.Println("first")
+	c.ExpectFile(filepath.Join("testdata", "first.golden"))
+	c.Println("second")
+	c.ExpectFile(filepath.Join("testdata", "second.golden"))
+
+	patch := fakeFs[patchPath]
+	if !strings.HasPrefix(patch, "Updates recorded by github.com/BestFriendChris/go-ic in run 42.") {
+		t.Errorf("expected the patch to name this run:\n%s", patch)
+	}
+	if strings.Contains(patch, "stale") {
+		t.Errorf("expected the earlier run's update to be dropped:\n%s", patch)
+	}
+	for _, want := range []string{"\n+first\n", "\n+second\n"} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("expected the patch to contain %q in:\n%s", want, patch)
+		}
+	}
+}
+
+func TestIC_Snapshot(t *testing.T) {
+	_, testFile, _, _ := runtime.Caller(0)
+	docPath := ic.SnapshotDocPath(testFile)
+	fakeFs := map[string]string{}
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	nt.TestName = "TestReport/monthly"
+
+	c.Println("report")
+	c.Snapshot("summary")
+
+	want := fmt.Sprintf(`IC: snapshot "TestReport/monthly summary" in %s does not exist. enable update with "-test.icupdate" flag or set the IC_UPDATE env var to anything`, docPath)
+	if !nt.Failed || len(nt.Output) != 1 || nt.Output[0] != want {
+		t.Errorf("\n got: %#v\nwant: %q", nt.Output, want)
+	}
+
+	ofc.EnvEnabled = true
+	for _, name := range []string{"summary", "details"} {
+		nt.Reset()
+		c.Println(name, "report")
+		c.Snapshot(name)
+	}
+	wantDoc := `Snapshots recorded by github.com/BestFriendChris/go-ic. Update them with IC_UPDATE.
+-- TestReport/monthly details --
+details report
+
+-- TestReport/monthly summary --
+summary report
+
+`
+	if got := fakeFs[docPath]; got != wantDoc {
+		t.Errorf("\n got: %q\nwant: %q", got, wantDoc)
+	}
+
+	nt.Reset()
+	c.Println("summary report")
+	c.Snapshot("summary")
+	if nt.Failed {
+		t.Errorf("expected the snapshot to match: %#v", nt.Output)
+	}
+
+	nt.Reset()
+	ofc.EnvEnabled = false
+	c.Println("changed report")
+	c.Snapshot("summary")
+	if !nt.Exited || len(nt.Output) != 1 || !strings.Contains(nt.Output[0], "-changed report\n+summary report\n") {
+		t.Errorf("expected the mismatch to fail the test with a diff: %#v", nt.Output)
+	}
+}
+
+func TestIC_Snapshot_updatePatch(t *testing.T) {
+	_, testFile, _, _ := runtime.Caller(0)
+	docPath := ic.SnapshotDocPath(testFile)
+	fakeFs := map[string]string{}
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	nt.TestName = "TestReport"
+	patchPath := filepath.Join(t.TempDir(), "ic.diff")
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:" + patchPath
+
+	// Every snapshot updated during the run ends up in the patch
+	c.Print("first")
+	c.Snapshot("a")
+	c.Print("second")
+	c.Snapshot("b")
+
+	if _, found := fakeFs[docPath]; found {
+		t.Error("expected the snapshots to be left alone")
+	}
+	for _, want := range []string{"+-- TestReport a --\n+first\n", "+-- TestReport b --\n+second\n"} {
+		if !strings.Contains(fakeFs[patchPath], want) {
+			t.Errorf("expected the patch to contain %q in:\n%s", want, fakeFs[patchPath])
+		}
+	}
+}
+
 func TestIC_PrintVals(t *testing.T) {
 	c := ic.New(t)
 
@@ -374,6 +1214,62 @@ func TestIC_PrintTable(t *testing.T) {
 		`)
 }
 
+func TestIC_PrintHexDump(t *testing.T) {
+	c := ic.New(t)
+	c.PrintHexDump([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	c.Expect(`
+		00000000: 4745 5420 2f20 4854 5450 2f31 2e31 0d0a  GET / HTTP/1.1..
+		00000010: 486f 7374 3a20 6578 616d 706c 652e 636f  Host: example.co
+		00000020: 6d0d 0a0d 0a                             m....
+		`)
+
+	c.ExpectBytes([]byte{0x00, 0x01, 0x7f, 0x80, 0xff, '`'}, "00000000: 0001 7f80 ff60                           .....`")
+}
+
+func TestIC_ExpectBytes_fail(t *testing.T) {
+	c, nt, _ := newNullable()
+	c.ExpectBytes([]byte("hello, world"), `00000000: 6865 6c6c 6f2c 2057 6f72 6c64 21         hello, World!`)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	if !nt.Exited {
+		t.Error("Expected this to have exited the test")
+	}
+
+	want := []string{
+		`
+ got: "00000000: 6865 6c6c 6f2c 2077 6f72 6c64            hello, world"
+                                  ^            ^^                ^
+want: "00000000: 6865 6c6c 6f2c 2057 6f72 6c64 21         hello, World!"
+                                  ^            ^^                ^    ^`,
+		"IC: first difference at offset 0x00000007 (7): got 0x77, want 0x57. got 12 bytes, want 13",
+	}
+	if !reflect.DeepEqual(nt.Output, want) {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", nt.Output, want)
+	}
+}
+
+func TestIC_ExpectBytes_whenEmpty_updateEnabled(t *testing.T) {
+	fakeFs := makeFakeFs()
+	c, nt, ofc := ic.NewNullable(&fakeFs)
+	ofc.FlagEnabled = true
+
+	c.ExpectBytes([]byte("binary\x00data\n"), "")
+	_, fName, line, _ := runtime.Caller(0)
+
+	if !nt.Failed {
+		t.Error("Expected this to fail")
+	}
+
+	want := "\tc.ExpectBytes([]byte(\"binary\\x00data\\n\"), `00000000: 6269 6e61 7279 0064 6174 610a            binary.data.`)"
+	got := strings.Split(fakeFs[fName], "\n")[line-2]
+	if got != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 func TestIC_replaceOnEmpty_1(t *testing.T) {
 	t.Skip("example of updating the test file")
 	c := ic.New(t)
@@ -496,7 +1392,7 @@ func TestComplex(t *testing.T) {
 
 	c.Println("Whenever you want to update your expectation,")
 	c.Println("simply remove all content in the string and run the tests again")
-	c.Println("Only one test will be replaced at a time, so multiple runs may be required")
+	c.Println("Every empty expectation will be filled in by a single run")
 
 	c.Println()
 	c.PrintSection("ExpectAndContinue")
@@ -584,7 +1480,7 @@ func TestComplex(t *testing.T) {
 		################################################################################
 		Whenever you want to update your expectation,
 		simply remove all content in the string and run the tests again
-		Only one test will be replaced at a time, so multiple runs may be required
+		Every empty expectation will be filled in by a single run
 		
 		################################################################################
 		# ExpectAndContinue
@@ -617,21 +1513,22 @@ func TestComplex(t *testing.T) {
 		`)
 }
 
-func newNullable() (ic.IC, *ic.NullTester, *atomic.Bool, *cmd.OverridableFlagChecker) {
+func newNullable() (ic.IC, *ic.NullTester, *cmd.OverridableFlagChecker) {
 	fakeFs := makeFakeFs()
 	return ic.NewNullable(&fakeFs)
 }
 
 func makeFakeFs() (fakeFs map[string]string) {
-	_, fName, lineNo, _ := runtime.Caller(0)
+	_, fName, _, _ := runtime.Caller(0)
 
-	var sb strings.Builder
-	for i := 0; i < lineNo+10; i++ {
-		_, _ = fmt.Fprintf(&sb, "line %d: Expect(``)\n", i+1)
+	// The updater parses the test file, so the fake starts as a copy of this one
+	src, err := os.ReadFile(fName)
+	if err != nil {
+		panic(err)
 	}
 
 	fakeFs = map[string]string{
-		fName: sb.String(),
+		fName: string(src),
 	}
 	return
 }
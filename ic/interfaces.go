@@ -8,6 +8,7 @@ type Tester interface {
 	Log(args ...any)
 	Logf(format string, args ...any)
 	Helper()
+	Name() string
 }
 
 // DebugStringer allows for exactly defining the debug string
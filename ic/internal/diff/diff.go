@@ -0,0 +1,350 @@
+// Package diff compares sequences of lines and writes unified diffs of them.
+// It has two algorithms: Myers, which finds a shortest edit script, and
+// patience, which lines up the lines that are unique to both sides first and
+// so keeps functions and blocks of text together.
+package diff
+
+// OpCode describes how to turn A[I1:I2] into B[J1:J2]. Tag is 'e' when the
+// lines are equal, 'd' when the lines of A are deleted, 'i' when the lines of
+// B are inserted and 'r' when the lines of A are replaced by those of B.
+type OpCode struct {
+	Tag    byte
+	I1, I2 int
+	J1, J2 int
+}
+
+// Algorithm returns the opcodes turning a into b
+type Algorithm func(a, b []string) []OpCode
+
+// Myers finds the shortest edit script turning a into b, using the linear
+// space version of Myers' algorithm
+func Myers(a, b []string) []OpCode {
+	m := newMatcher(a, b)
+	m.myers(0, len(a), 0, len(b))
+	return m.opCodes()
+}
+
+// Patience matches the lines that appear exactly once in both a and b, then
+// diffs the gaps between them the same way. Gaps without unique lines are
+// diffed with Myers.
+func Patience(a, b []string) []OpCode {
+	m := newMatcher(a, b)
+	m.patience(0, len(a), 0, len(b))
+	return m.opCodes()
+}
+
+// Ratio returns how alike a and b are, from 0 when they have nothing in
+// common to 1 when they are the same: twice the number of elements matched
+// by opcodes, over the total number of elements.
+func Ratio(opCodes []OpCode, a, b []string) float64 {
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+	matches := 0
+	for _, op := range opCodes {
+		if op.Tag == 'e' {
+			matches += op.I2 - op.I1
+		}
+	}
+	return 2 * float64(matches) / float64(len(a)+len(b))
+}
+
+// matcher collects the pairs of lines that match between a and b. Lines are
+// interned as ints so they are cheap to compare.
+type matcher struct {
+	x, y    []int
+	matches [][2]int
+}
+
+func newMatcher(a, b []string) *matcher {
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		interned := make([]int, len(lines))
+		for i, line := range lines {
+			id, found := ids[line]
+			if !found {
+				id = len(ids)
+				ids[line] = id
+			}
+			interned[i] = id
+		}
+		return interned
+	}
+	return &matcher{x: intern(a), y: intern(b)}
+}
+
+func (m *matcher) match(i, j, n int) {
+	for k := 0; k < n; k++ {
+		m.matches = append(m.matches, [2]int{i + k, j + k})
+	}
+}
+
+// trim matches the lines x[aLo:aHi] and y[bLo:bHi] start with, returning the
+// bounds of what is left and the length of the common suffix, which the
+// caller must match once it is done with the rest
+func (m *matcher) trim(aLo, aHi, bLo, bHi int) (int, int, int, int, int) {
+	prefix := 0
+	for aLo+prefix < aHi && bLo+prefix < bHi && m.x[aLo+prefix] == m.y[bLo+prefix] {
+		prefix++
+	}
+	m.match(aLo, bLo, prefix)
+	aLo, bLo = aLo+prefix, bLo+prefix
+
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && m.x[aHi-suffix-1] == m.y[bHi-suffix-1] {
+		suffix++
+	}
+	return aLo, aHi - suffix, bLo, bHi - suffix, suffix
+}
+
+// myers matches x[aLo:aHi] against y[bLo:bHi]. Lines only found on one side
+// can't match anything, so they are left out of the search. That keeps
+// outputs with little in common from taking the longest to diff.
+func (m *matcher) myers(aLo, aHi, bLo, bHi int) {
+	inA := make(map[int]bool, aHi-aLo)
+	for _, line := range m.x[aLo:aHi] {
+		inA[line] = true
+	}
+	inB := make(map[int]bool, bHi-bLo)
+	for _, line := range m.y[bLo:bHi] {
+		inB[line] = true
+	}
+	sub := &matcher{}
+	var aIndex, bIndex []int
+	for i := aLo; i < aHi; i++ {
+		if inB[m.x[i]] {
+			sub.x = append(sub.x, m.x[i])
+			aIndex = append(aIndex, i)
+		}
+	}
+	for j := bLo; j < bHi; j++ {
+		if inA[m.y[j]] {
+			sub.y = append(sub.y, m.y[j])
+			bIndex = append(bIndex, j)
+		}
+	}
+	sub.bisect(0, len(sub.x), 0, len(sub.y))
+	for _, match := range sub.matches {
+		m.matches = append(m.matches, [2]int{aIndex[match[0]], bIndex[match[1]]})
+	}
+}
+
+// bisect matches x[aLo:aHi] against y[bLo:bHi] by finding the middle snake
+// of a shortest edit script and recursing on either side of it
+func (m *matcher) bisect(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi, suffix := m.trim(aLo, aHi, bLo, bHi)
+	if aLo < aHi && bLo < bHi {
+		if x, y, found := m.middleSnake(aLo, aHi, bLo, bHi); found {
+			m.bisect(aLo, x, bLo, y)
+			m.bisect(x, aHi, y, bHi)
+		}
+	}
+	m.match(aHi, bHi, suffix)
+}
+
+// middleSnake runs the search for a shortest edit script from both ends at
+// once, returning the point where the two searches meet. It reports false
+// when the ranges have nothing in common.
+func (m *matcher) middleSnake(aLo, aHi, bLo, bHi int) (x, y int, found bool) {
+	n, mm := aHi-aLo, bHi-bLo
+	maxD := (n + mm + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	forward := make([]int, size)
+	backward := make([]int, size)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - mm
+	// With an odd delta the searches meet on a forward step, otherwise on a
+	// backward one
+	isOdd := delta%2 != 0
+	// Diagonals that ran off the edge of the grid are skipped afterwards
+	k1Start, k1End, k2Start, k2End := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k1 := -d + k1Start; k1 <= d-k1End; k1 += 2 {
+			k1Offset := offset + k1
+			var x1 int
+			if k1 == -d || (k1 != d && forward[k1Offset-1] < forward[k1Offset+1]) {
+				x1 = forward[k1Offset+1]
+			} else {
+				x1 = forward[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < mm && m.x[aLo+x1] == m.y[bLo+y1] {
+				x1++
+				y1++
+			}
+			forward[k1Offset] = x1
+			switch {
+			case x1 > n:
+				k1End += 2
+			case y1 > mm:
+				k1Start += 2
+			case isOdd:
+				k2Offset := offset + delta - k1
+				if k2Offset >= 0 && k2Offset < size && backward[k2Offset] != -1 {
+					if x1 >= n-backward[k2Offset] {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+
+		for k2 := -d + k2Start; k2 <= d-k2End; k2 += 2 {
+			k2Offset := offset + k2
+			var x2 int
+			if k2 == -d || (k2 != d && backward[k2Offset-1] < backward[k2Offset+1]) {
+				x2 = backward[k2Offset+1]
+			} else {
+				x2 = backward[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < mm && m.x[aHi-x2-1] == m.y[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			backward[k2Offset] = x2
+			switch {
+			case x2 > n:
+				k2End += 2
+			case y2 > mm:
+				k2Start += 2
+			case !isOdd:
+				k1Offset := offset + delta - k2
+				if k1Offset >= 0 && k1Offset < size && forward[k1Offset] != -1 {
+					x1 := forward[k1Offset]
+					y1 := offset + x1 - k1Offset
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// patience matches x[aLo:aHi] against y[bLo:bHi] by anchoring on the longest
+// increasing run of lines unique to both
+func (m *matcher) patience(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi, suffix := m.trim(aLo, aHi, bLo, bHi)
+	if aLo < aHi && bLo < bHi {
+		anchors := m.uniqueAnchors(aLo, aHi, bLo, bHi)
+		if len(anchors) == 0 {
+			m.myers(aLo, aHi, bLo, bHi)
+		} else {
+			i, j := aLo, bLo
+			for _, anchor := range anchors {
+				m.patience(i, anchor[0], j, anchor[1])
+				m.match(anchor[0], anchor[1], 1)
+				i, j = anchor[0]+1, anchor[1]+1
+			}
+			m.patience(i, aHi, j, bHi)
+		}
+	}
+	m.match(aHi, bHi, suffix)
+}
+
+// uniqueAnchors returns the longest run of lines that appear once in each
+// range, in the same order in both
+func (m *matcher) uniqueAnchors(aLo, aHi, bLo, bHi int) [][2]int {
+	type occurrence struct {
+		countA, countB int
+		indexA, indexB int
+	}
+	lines := make(map[int]*occurrence)
+	for i := aLo; i < aHi; i++ {
+		o := lines[m.x[i]]
+		if o == nil {
+			o = &occurrence{}
+			lines[m.x[i]] = o
+		}
+		o.countA++
+		o.indexA = i
+	}
+	for j := bLo; j < bHi; j++ {
+		if o := lines[m.y[j]]; o != nil {
+			o.countB++
+			o.indexB = j
+		}
+	}
+	var unique [][2]int
+	for i := aLo; i < aHi; i++ {
+		if o := lines[m.x[i]]; o.countA == 1 && o.countB == 1 {
+			unique = append(unique, [2]int{o.indexA, o.indexB})
+		}
+	}
+	return longestIncreasing(unique)
+}
+
+// longestIncreasing returns the longest run of pairs, already in order of
+// their first element, whose second elements increase. It is found by
+// patience sorting.
+func longestIncreasing(pairs [][2]int) [][2]int {
+	if len(pairs) == 0 {
+		return nil
+	}
+	// tops holds the index of the pair on top of each pile, and prev links
+	// each pair to the top of the pile to its left when it was placed
+	var tops []int
+	prev := make([]int, len(pairs))
+	for i, pair := range pairs {
+		lo, hi := 0, len(tops)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if pairs[tops[mid]][1] < pair[1] {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = tops[lo-1]
+		}
+		if lo == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[lo] = i
+		}
+	}
+	run := make([][2]int, len(tops))
+	for i, k := len(tops)-1, tops[len(tops)-1]; i >= 0; i, k = i-1, prev[k] {
+		run[i] = pairs[k]
+	}
+	return run
+}
+
+// opCodes turns the matched lines, which are in order, into opcodes covering
+// all of x and y
+func (m *matcher) opCodes() []OpCode {
+	var codes []OpCode
+	add := func(tag byte, i1, i2, j1, j2 int) {
+		if last := len(codes) - 1; tag == 'e' && last >= 0 && codes[last].Tag == 'e' {
+			codes[last].I2, codes[last].J2 = i2, j2
+			return
+		}
+		codes = append(codes, OpCode{tag, i1, i2, j1, j2})
+	}
+	addChange := func(i1, i2, j1, j2 int) {
+		switch {
+		case i1 < i2 && j1 < j2:
+			add('r', i1, i2, j1, j2)
+		case i1 < i2:
+			add('d', i1, i2, j1, j2)
+		case j1 < j2:
+			add('i', i1, i2, j1, j2)
+		}
+	}
+	i, j := 0, 0
+	for _, match := range m.matches {
+		addChange(i, match[0], j, match[1])
+		add('e', match[0], match[0]+1, match[1], match[1]+1)
+		i, j = match[0]+1, match[1]+1
+	}
+	addChange(i, len(m.x), j, len(m.y))
+	return codes
+}
@@ -0,0 +1,41 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// benchLines returns two 10k line outputs, the second with one line in 50
+// changed, removed or added.
+func benchLines() (got, want []string) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		line := fmt.Sprintf("row %5d | value %d\n", i, r.Intn(1000))
+		got = append(got, line)
+		switch r.Intn(50) {
+		case 0:
+			want = append(want, fmt.Sprintf("row %5d | value %d\n", i, r.Intn(1000)))
+		case 1:
+		case 2:
+			want = append(want, line, "added\n")
+		default:
+			want = append(want, line)
+		}
+	}
+	return got, want
+}
+
+func BenchmarkMyers(b *testing.B) {
+	got, want := benchLines()
+	for i := 0; i < b.N; i++ {
+		_ = Unified{A: got, B: want, Context: 3, Algorithm: Myers}.String()
+	}
+}
+
+func BenchmarkPatience(b *testing.B) {
+	got, want := benchLines()
+	for i := 0; i < b.N; i++ {
+		_ = Unified{A: got, B: want, Context: 3, Algorithm: Patience}.String()
+	}
+}
@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []OpCode
+	}{
+		{"same", "abc", "abc", []OpCode{{'e', 0, 3, 0, 3}}},
+		{"both empty", "", "", nil},
+		{"insert", "ac", "abc", []OpCode{{'e', 0, 1, 0, 1}, {'i', 1, 1, 1, 2}, {'e', 1, 2, 2, 3}}},
+		{"delete", "abc", "ac", []OpCode{{'e', 0, 1, 0, 1}, {'d', 1, 2, 1, 1}, {'e', 2, 3, 1, 2}}},
+		{"replace", "abc", "axc", []OpCode{{'e', 0, 1, 0, 1}, {'r', 1, 2, 1, 2}, {'e', 2, 3, 2, 3}}},
+		{"nothing in common", "ab", "xyz", []OpCode{{'r', 0, 2, 0, 3}}},
+		{"from empty", "", "ab", []OpCode{{'i', 0, 0, 0, 2}}},
+	}
+	for _, algorithm := range []struct {
+		name string
+		diff Algorithm
+	}{{"Myers", Myers}, {"Patience", Patience}} {
+		for _, tt := range tests {
+			t.Run(algorithm.name+"/"+tt.name, func(t *testing.T) {
+				got := algorithm.diff(chars(tt.a), chars(tt.b))
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMyers_isShortest(t *testing.T) {
+	a, b := chars("abcabba"), chars("cbabac")
+	matched := 0
+	for _, op := range Myers(a, b) {
+		if op.Tag == 'e' {
+			matched += op.I2 - op.I1
+		}
+	}
+	// The example from Myers' paper has a longest common subsequence of 4
+	if matched != 4 {
+		t.Errorf("matched %d lines, want 4", matched)
+	}
+}
+
+func TestPatience_insertedBlock(t *testing.T) {
+	a := lines("func a() {", "\ta()", "}", "", "func c() {", "\tc()", "}")
+	b := lines("func a() {", "\ta()", "}", "", "func b() {", "\tb()", "}", "", "func c() {", "\tc()", "}")
+	got := Unified{A: a, B: b, FromFile: "a", ToFile: "b", Context: 1, Algorithm: Patience}.String()
+	want := `--- a
++++ b
+@@ -4,2 +4,6 @@
+ 
++func b() {
++	b()
++}
++
+ func c() {
+`
+	if got != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func Test_longestIncreasing(t *testing.T) {
+	pairs := [][2]int{{0, 9}, {1, 4}, {2, 6}, {3, 1}, {4, 7}, {5, 8}, {6, 2}}
+	want := [][2]int{{1, 4}, {2, 6}, {4, 7}, {5, 8}}
+	if got := longestIncreasing(pairs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10")
+	b := lines("1", "two", "3", "4", "5", "6", "7", "8", "9", "ten")
+
+	t.Run("separate hunks", func(t *testing.T) {
+		got := Unified{A: a, B: b, FromFile: "Got", ToFile: "Want", Context: 2}.String()
+		want := `--- Got
++++ Want
+@@ -1,4 +1,4 @@
+ 1
+-2
++two
+ 3
+ 4
+@@ -8,3 +8,3 @@
+ 8
+ 9
+-10
++ten
+`
+		if got != want {
+			t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("one hunk", func(t *testing.T) {
+		got := Unified{A: a, B: b, FromFile: "Got", ToFile: "Want", Context: 4}.String()
+		if strings.Count(got, "@@ ") != 1 {
+			t.Errorf("want one hunk in:\n%s", got)
+		}
+	})
+
+	t.Run("no newline at end", func(t *testing.T) {
+		got := Unified{A: []string{"a\n", "b"}, B: []string{"a\n", "b\n"}, FromFile: "a", ToFile: "b", Context: 3}.String()
+		want := `--- a
++++ b
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`
+		if got != want {
+			t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("same", func(t *testing.T) {
+		if got := (Unified{A: a, B: a, Context: 3}).String(); got != "" {
+			t.Errorf("got %q, want no diff", got)
+		}
+	})
+}
+
+func TestRatio(t *testing.T) {
+	a, b := chars("abcd"), chars("abxd")
+	if got := Ratio(Myers(a, b), a, b); got != 0.75 {
+		t.Errorf("got %v, want 0.75", got)
+	}
+}
+
+func chars(s string) []string {
+	return strings.Split(s, "")
+}
+
+func lines(ls ...string) []string {
+	for i := range ls {
+		ls[i] += "\n"
+	}
+	return ls
+}
@@ -0,0 +1,118 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unified describes a unified diff turning the lines A into the lines B.
+// Lines keep their newlines. A line without one, at the end of a file, is
+// marked with "\ No newline at end of file" like diff does.
+type Unified struct {
+	A, B []string
+	// FromFile and ToFile name A and B in the "---" and "+++" headers
+	FromFile, ToFile string
+	// Context is the number of unchanged lines shown around each change
+	Context int
+	// Algorithm finds the changes. It defaults to Myers.
+	Algorithm Algorithm
+}
+
+// String returns the diff, or "" when A and B are the same
+func (u Unified) String() string {
+	algorithm := u.Algorithm
+	if algorithm == nil {
+		algorithm = Myers
+	}
+	var sb strings.Builder
+	for i, group := range GroupOpCodes(algorithm(u.A, u.B), u.Context) {
+		if i == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", u.FromFile, u.ToFile)
+		}
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", formatRange(first.I1, last.I2), formatRange(first.J1, last.J2))
+		for _, op := range group {
+			if op.Tag == 'e' {
+				writeLines(&sb, " ", u.A[op.I1:op.I2])
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				writeLines(&sb, "-", u.A[op.I1:op.I2])
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				writeLines(&sb, "+", u.B[op.J1:op.J2])
+			}
+		}
+	}
+	return sb.String()
+}
+
+func writeLines(sb *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(prefix + line)
+		if !strings.HasSuffix(line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// formatRange writes the lines start up to stop as a hunk range, which
+// counts lines from 1 and leaves out a length of 1
+func formatRange(start, stop int) string {
+	length := stop - start
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// GroupOpCodes splits opcodes into hunks, each holding changes along with up
+// to context unchanged lines around them. Changes closer than twice context
+// share a hunk. It returns no hunks when nothing changed.
+func GroupOpCodes(opCodes []OpCode, context int) [][]OpCode {
+	if len(opCodes) == 0 {
+		return nil
+	}
+	codes := append([]OpCode(nil), opCodes...)
+	if first := &codes[0]; first.Tag == 'e' {
+		first.I1 = max(first.I1, first.I2-context)
+		first.J1 = max(first.J1, first.J2-context)
+	}
+	if last := &codes[len(codes)-1]; last.Tag == 'e' {
+		last.I2 = min(last.I1+context, last.I2)
+		last.J2 = min(last.J1+context, last.J2)
+	}
+
+	var groups [][]OpCode
+	var group []OpCode
+	for _, op := range codes {
+		if op.Tag == 'e' && op.I2-op.I1 > 2*context {
+			group = append(group, OpCode{'e', op.I1, min(op.I2, op.I1+context), op.J1, min(op.J2, op.J1+context)})
+			groups = append(groups, group)
+			group = nil
+			op.I1, op.J1 = max(op.I1, op.I2-context), max(op.J1, op.J2-context)
+		}
+		group = append(group, op)
+	}
+	if len(group) > 0 && !(len(group) == 1 && group[0].Tag == 'e') {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
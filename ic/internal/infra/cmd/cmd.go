@@ -3,8 +3,63 @@ package cmd
 import (
 	"flag"
 	"os"
+	"strconv"
+	"strings"
 )
 
+// UpdateMode controls which expectations IC will rewrite
+type UpdateMode int
+
+const (
+	// UpdateDisabled never rewrites test files
+	UpdateDisabled UpdateMode = iota
+	// UpdateEmpty only fills in empty expectations
+	UpdateEmpty
+	// UpdateAll rewrites every expectation that does not match
+	UpdateAll
+	// UpdatePatch records what UpdateAll would rewrite as a patch file
+	// instead of touching the test files
+	UpdatePatch
+	// UpdatePending records what UpdateAll would rewrite as pending
+	// snapshots to be accepted later
+	UpdatePending
+	// UpdatePrune leaves expectations alone, but deletes the stored
+	// snapshots that no test read
+	UpdatePrune
+)
+
+const patchPrefix = "patch:"
+
+func (m UpdateMode) String() string {
+	switch m {
+	case UpdateDisabled:
+		return "disabled"
+	case UpdateEmpty:
+		return "empty"
+	case UpdateAll:
+		return "all"
+	case UpdatePatch:
+		return "patch"
+	case UpdatePending:
+		return "pending"
+	case UpdatePrune:
+		return "prune"
+	default:
+		panic("unknown UpdateMode")
+	}
+}
+
+// Updates reports whether empty expectations are filled in
+func (m UpdateMode) Updates() bool {
+	return m != UpdateDisabled && m != UpdatePrune
+}
+
+// RewritesMismatches reports whether expectations that don't match are
+// updated, and not just empty ones
+func (m UpdateMode) RewritesMismatches() bool {
+	return m == UpdateAll || m == UpdatePatch || m == UpdatePending
+}
+
 type Cmd struct {
 	fc flagChecker
 }
@@ -23,32 +78,213 @@ func NewNullable() (*Cmd, *OverridableFlagChecker) {
 }
 
 func (c *Cmd) IsUpdateEnabled() bool {
-	return c.fc.IsUpdateEnabled()
+	return c.UpdateMode().Updates()
+}
+
+// IsFiltered reports whether only some of the tests are running, because of
+// the "-test.run", "-test.skip" or "-test.short" flags, or none of them are,
+// because of "-test.list"
+func (c *Cmd) IsFiltered() bool {
+	return c.fc.RunFiltered()
+}
+
+// UseColor reports whether failure output should be colored. "NO_COLOR" or
+// "IC_COLOR=never" turn color off and "IC_COLOR=always" turns it on.
+// Otherwise output is colored when stderr is a terminal, unless running in CI.
+func (c *Cmd) UseColor() bool {
+	if c.fc.NoColorEnv() {
+		return false
+	}
+	value, _ := c.fc.ColorEnv()
+	switch {
+	case strings.EqualFold(value, "never"):
+		return false
+	case strings.EqualFold(value, "always"):
+		return true
+	}
+	return c.fc.IsTerminal() && !c.fc.IsCI()
+}
+
+// DiffStyle returns the "IC_DIFF" env var, which picks how failures are diffed
+func (c *Cmd) DiffStyle() string {
+	value, _ := c.fc.DiffEnv()
+	return value
+}
+
+// UpdateMode reports the mode requested by the "-test.icupdate" flag or the
+// "IC_UPDATE" env var. The flag wins when both are set.
+func (c *Cmd) UpdateMode() UpdateMode {
+	value, isSet := c.updateValue()
+	if !isSet {
+		return UpdateDisabled
+	}
+	if strings.EqualFold(value, "all") {
+		return UpdateAll
+	}
+	if strings.HasPrefix(value, patchPrefix) {
+		return UpdatePatch
+	}
+	if strings.EqualFold(value, "pending") {
+		return UpdatePending
+	}
+	if strings.EqualFold(value, "prune") {
+		return UpdatePrune
+	}
+	return UpdateEmpty
+}
+
+// PatchPath is the file to write when the mode is UpdatePatch
+func (c *Cmd) PatchPath() string {
+	value, _ := c.updateValue()
+	return strings.TrimPrefix(value, patchPrefix)
+}
+
+// RunID identifies the run of "go test" this test binary is part of. The go
+// command runs the binary of every package, so they all share it as parent.
+func (c *Cmd) RunID() string {
+	return c.fc.RunID()
+}
+
+func (c *Cmd) updateValue() (string, bool) {
+	if value, isSet := c.fc.UpdateFlag(); isSet {
+		return value, true
+	}
+	return c.fc.UpdateEnv()
 }
 
 type flagChecker interface {
-	IsUpdateEnabled() bool
+	UpdateFlag() (value string, isSet bool)
+	UpdateEnv() (value string, isSet bool)
+	RunFiltered() bool
+	ColorEnv() (value string, isSet bool)
+	NoColorEnv() bool
+	IsTerminal() bool
+	IsCI() bool
+	DiffEnv() (value string, isSet bool)
+	RunID() string
 }
 
 type globalFlagChecker struct{}
 
-func (g *globalFlagChecker) IsUpdateEnabled() bool {
-	_, envUpdateEnabled := os.LookupEnv("IC_UPDATE")
-	return *updateEnabled || envUpdateEnabled
+func (g *globalFlagChecker) UpdateFlag() (string, bool) {
+	return updateFlag.value, updateFlag.isSet
+}
+
+func (g *globalFlagChecker) UpdateEnv() (string, bool) {
+	return os.LookupEnv("IC_UPDATE")
+}
+
+func (g *globalFlagChecker) RunFiltered() bool {
+	for _, name := range []string{"test.run", "test.skip", "test.list"} {
+		// test.skip only exists in newer versions of Go
+		if f := flag.Lookup(name); f != nil && f.Value.String() != "" {
+			return true
+		}
+	}
+	// Tests commonly skip themselves in short mode
+	f := flag.Lookup("test.short")
+	return f != nil && f.Value.String() == "true"
+}
+
+func (g *globalFlagChecker) ColorEnv() (string, bool) {
+	return os.LookupEnv("IC_COLOR")
+}
+
+// NoColorEnv follows https://no-color.org, which ignores an empty NO_COLOR
+func (g *globalFlagChecker) NoColorEnv() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+func (g *globalFlagChecker) IsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (g *globalFlagChecker) IsCI() bool {
+	return os.Getenv("CI") != ""
+}
+
+func (g *globalFlagChecker) DiffEnv() (string, bool) {
+	return os.LookupEnv("IC_DIFF")
+}
+
+func (g *globalFlagChecker) RunID() string {
+	return strconv.Itoa(os.Getppid())
 }
 
 type OverridableFlagChecker struct {
 	FlagEnabled, EnvEnabled bool
+	FlagValue, EnvValue     string
+	Filtered                bool
+	ColorEnabled            bool
+	ColorValue              string
+	NoColor, Terminal, CI   bool
+	DiffValue               string
+	RunIDValue              string
+}
+
+func (o *OverridableFlagChecker) UpdateFlag() (string, bool) {
+	return o.FlagValue, o.FlagEnabled
+}
+
+func (o *OverridableFlagChecker) UpdateEnv() (string, bool) {
+	return o.EnvValue, o.EnvEnabled
+}
+
+func (o *OverridableFlagChecker) RunFiltered() bool {
+	return o.Filtered
+}
+
+func (o *OverridableFlagChecker) ColorEnv() (string, bool) {
+	return o.ColorValue, o.ColorEnabled
+}
+
+func (o *OverridableFlagChecker) NoColorEnv() bool {
+	return o.NoColor
+}
+
+func (o *OverridableFlagChecker) IsTerminal() bool {
+	return o.Terminal
+}
+
+func (o *OverridableFlagChecker) IsCI() bool {
+	return o.CI
+}
+
+func (o *OverridableFlagChecker) DiffEnv() (string, bool) {
+	return o.DiffValue, o.DiffValue != ""
+}
+
+func (o *OverridableFlagChecker) RunID() string {
+	return o.RunIDValue
+}
+
+// updateFlagValue behaves like a bool flag so "-test.icupdate" still works on
+// its own, but also accepts a mode such as "-test.icupdate=all"
+type updateFlagValue struct {
+	value string
+	isSet bool
+}
+
+func (u *updateFlagValue) String() string {
+	return u.value
+}
+
+func (u *updateFlagValue) Set(s string) error {
+	u.value = s
+	u.isSet = s != "false"
+	return nil
 }
 
-func (o *OverridableFlagChecker) IsUpdateEnabled() bool {
-	return o.FlagEnabled || o.EnvEnabled
+func (u *updateFlagValue) IsBoolFlag() bool {
+	return true
 }
 
 var (
-	updateEnabled *bool
+	updateFlag *updateFlagValue
 )
 
 func init() {
-	updateEnabled = flag.Bool("test.icupdate", false, "allow IC to update test files")
+	updateFlag = &updateFlagValue{}
+	flag.Var(updateFlag, "test.icupdate", `allow IC to update test files. Use "all" to also rewrite mismatched expectations, "patch:<file>" to write those updates to a patch instead, or "pending" to store them as pending snapshots, or "prune" to delete snapshots no test read`)
 }
@@ -0,0 +1,93 @@
+package cmd
+
+import "testing"
+
+func Test_UpdateMode(t *testing.T) {
+	tests := []struct {
+		name string
+		ofc  OverridableFlagChecker
+		want UpdateMode
+	}{
+		{"nothing set", OverridableFlagChecker{}, UpdateDisabled},
+		{"flag set", OverridableFlagChecker{FlagEnabled: true, FlagValue: "true"}, UpdateEmpty},
+		{"env set to anything", OverridableFlagChecker{EnvEnabled: true, EnvValue: "1"}, UpdateEmpty},
+		{"env set to empty", OverridableFlagChecker{EnvEnabled: true}, UpdateEmpty},
+		{"flag set to all", OverridableFlagChecker{FlagEnabled: true, FlagValue: "all"}, UpdateAll},
+		{"env set to all", OverridableFlagChecker{EnvEnabled: true, EnvValue: "ALL"}, UpdateAll},
+		{"flag wins over env", OverridableFlagChecker{FlagEnabled: true, EnvEnabled: true, EnvValue: "all"}, UpdateEmpty},
+		{"env set to patch", OverridableFlagChecker{EnvEnabled: true, EnvValue: "patch:out.diff"}, UpdatePatch},
+		{"flag set to pending", OverridableFlagChecker{FlagEnabled: true, FlagValue: "pending"}, UpdatePending},
+		{"env set to prune", OverridableFlagChecker{EnvEnabled: true, EnvValue: "prune"}, UpdatePrune},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ofc := NewNullable()
+			*ofc = tt.ofc
+			if got := c.UpdateMode(); got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+			if got := c.IsUpdateEnabled(); got != (tt.want != UpdateDisabled && tt.want != UpdatePrune) {
+				t.Errorf("IsUpdateEnabled() = %v for mode %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_PatchPath(t *testing.T) {
+	c, ofc := NewNullable()
+	ofc.EnvEnabled = true
+	ofc.EnvValue = "patch:path/to/out.diff"
+
+	if got, want := c.PatchPath(), "path/to/out.diff"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if !c.UpdateMode().RewritesMismatches() {
+		t.Error("expected patch mode to rewrite mismatches")
+	}
+}
+
+func Test_UseColor(t *testing.T) {
+	tests := []struct {
+		name string
+		ofc  OverridableFlagChecker
+		want bool
+	}{
+		{"nothing set", OverridableFlagChecker{}, false},
+		{"terminal", OverridableFlagChecker{Terminal: true}, true},
+		{"terminal in CI", OverridableFlagChecker{Terminal: true, CI: true}, false},
+		{"always", OverridableFlagChecker{ColorEnabled: true, ColorValue: "always"}, true},
+		{"always in CI", OverridableFlagChecker{ColorEnabled: true, ColorValue: "ALWAYS", CI: true}, true},
+		{"never", OverridableFlagChecker{ColorEnabled: true, ColorValue: "never", Terminal: true}, false},
+		{"NO_COLOR", OverridableFlagChecker{NoColor: true, Terminal: true}, false},
+		{"NO_COLOR wins over always", OverridableFlagChecker{NoColor: true, ColorEnabled: true, ColorValue: "always"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ofc := NewNullable()
+			*ofc = tt.ofc
+			if got := c.UseColor(); got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_updateFlagValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantIsSet bool
+	}{
+		{"true", true},
+		{"all", true},
+		{"false", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var u updateFlagValue
+			_ = u.Set(tt.value)
+			if u.isSet != tt.wantIsSet || u.String() != tt.value {
+				t.Errorf("got %+v", u)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package os_file
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = make(map[string]*sync.Mutex)
+)
+
+// lockFile locks f against other goroutines in this process. There are no
+// advisory file locks to guard against other processes here.
+func lockFile(f *os.File) (unlock func(), err error) {
+	name, err := filepath.Abs(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	fileLocksMu.Lock()
+	mu, found := fileLocks[name]
+	if !found {
+		mu = &sync.Mutex{}
+		fileLocks[name] = mu
+	}
+	fileLocksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock, nil
+}
@@ -3,9 +3,12 @@ package os_file
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 type OsFileManager struct {
@@ -30,6 +33,53 @@ func (fm OsFileManager) OpenRW(fName string) (*OsFile, error) {
 	return fm.fo.OpenFile(fName, os.O_RDWR, 0644)
 }
 
+// OpenCreate is OpenRW, but creates an empty file, along with any missing
+// parent directories, if fName doesn't exist yet
+func (fm OsFileManager) OpenCreate(fName string) (*OsFile, error) {
+	return fm.fo.OpenFile(fName, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// OpenRWLocked is OpenRW, but also takes an exclusive advisory lock on the
+// file that is held until Close. Other processes and goroutines opening the
+// file with a lock wait until then, so a read followed by a Rewrite can't
+// lose anyone else's changes.
+func (fm OsFileManager) OpenRWLocked(fName string) (*OsFile, error) {
+	return fm.fo.OpenFileLocked(fName, os.O_RDWR, 0644)
+}
+
+// OpenCreateLocked is OpenCreate with the lock of OpenRWLocked
+func (fm OsFileManager) OpenCreateLocked(fName string) (*OsFile, error) {
+	return fm.fo.OpenFileLocked(fName, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// ReadFile returns the contents of fName. The error satisfies
+// errors.Is(err, fs.ErrNotExist) when there is no such file.
+func (fm OsFileManager) ReadFile(fName string) ([]byte, error) {
+	file, err := fm.fo.OpenFile(fName, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.ReadAll()
+}
+
+// ReadDir returns the names of the files in dir, sorted. Directories are
+// left out. The error satisfies errors.Is(err, fs.ErrNotExist) when there is
+// no such directory.
+func (fm OsFileManager) ReadDir(dir string) ([]string, error) {
+	return fm.fo.ReadDir(dir)
+}
+
+// Exists reports whether there is a file or directory at path
+func (fm OsFileManager) Exists(path string) bool {
+	return fm.fo.Exists(path)
+}
+
+// Remove deletes the file fName
+func (fm OsFileManager) Remove(fName string) error {
+	return fm.fo.Remove(fName)
+}
+
 type OsFile struct {
 	f fileRewriter
 }
@@ -42,9 +92,15 @@ func (osf *OsFile) Scanner() *bufio.Scanner {
 	return bufio.NewScanner(osf.f)
 }
 
+func (osf *OsFile) ReadAll() ([]byte, error) {
+	return io.ReadAll(osf.f)
+}
+
+// Rewrite replaces the entire contents of the file. The new contents are
+// written to a temporary file next to the original, synced, and renamed over
+// the original so a crash never leaves a partially written file behind.
 func (osf *OsFile) Rewrite(bytes []byte) error {
-	_, err := osf.f.WriteAt(bytes, 0)
-	return err
+	return osf.f.Rewrite(bytes)
 }
 
 /********************************************************************************
@@ -53,33 +109,136 @@ private nullable interfaces - fileOpener
 
 type fileOpener interface {
 	OpenFile(name string, flag int, perm os.FileMode) (*OsFile, error)
+	OpenFileLocked(name string, flag int, perm os.FileMode) (*OsFile, error)
+	ReadDir(dir string) ([]string, error)
+	Exists(path string) bool
+	Remove(name string) error
 }
 
 type osFileOpener struct{}
 
 func (fo *osFileOpener) OpenFile(name string, flag int, perm os.FileMode) (*OsFile, error) {
+	if flag&os.O_CREATE != 0 {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return nil, err
+		}
+	}
 	file, err := os.OpenFile(name, flag, perm)
 	if err != nil {
 		return nil, err
 	}
-	return &OsFile{f: file}, nil
+	return &OsFile{f: &osFileRewriter{File: file}}, nil
+}
+
+func (fo *osFileOpener) OpenFileLocked(name string, flag int, perm os.FileMode) (*OsFile, error) {
+	for {
+		osf, err := fo.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		ofr := osf.f.(*osFileRewriter)
+		ofr.unlock, err = lockFile(ofr.File)
+		if err != nil {
+			_ = ofr.File.Close()
+			return nil, err
+		}
+
+		// Rewrite renames a new file into place, so whoever held the lock
+		// may have replaced the file we were waiting on
+		lockedInfo, err := ofr.Stat()
+		if err != nil {
+			osf.Close()
+			return nil, err
+		}
+		currentInfo, err := os.Stat(name)
+		if err == nil && os.SameFile(lockedInfo, currentInfo) {
+			return osf, nil
+		}
+		osf.Close()
+		if err != nil && !(os.IsNotExist(err) && flag&os.O_CREATE != 0) {
+			return nil, err
+		}
+	}
+}
+
+func (fo *osFileOpener) ReadDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (fo *osFileOpener) Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (fo *osFileOpener) Remove(name string) error {
+	return os.Remove(name)
 }
 
 type fakeFileOpener struct {
 	fakeFs *map[string]string
 }
 
-func (f *fakeFileOpener) OpenFile(name string, _ int, _ os.FileMode) (*OsFile, error) {
+func (f *fakeFileOpener) OpenFile(name string, flag int, _ os.FileMode) (*OsFile, error) {
 	body, found := (*f.fakeFs)[name]
-	if !found {
-		return nil, fmt.Errorf("file %q not found", name)
+	if !found && flag&os.O_CREATE != 0 {
+		(*f.fakeFs)[name] = ""
+	} else if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 	}
 
 	bodyBytes := []byte(body)
 	reader := bytes.NewReader(bodyBytes)
-	writer := bytes.Buffer{}
 
-	return &OsFile{f: &fakeFileRewriter{fName: name, fakeFs: f.fakeFs, reader: reader, writer: &writer}}, nil
+	return &OsFile{f: &fakeFileRewriter{fName: name, fakeFs: f.fakeFs, reader: reader}}, nil
+}
+
+func (f *fakeFileOpener) OpenFileLocked(name string, flag int, perm os.FileMode) (*OsFile, error) {
+	// Fake files are only used from one goroutine, so there is nothing to lock
+	return f.OpenFile(name, flag, perm)
+}
+
+func (f *fakeFileOpener) ReadDir(dir string) ([]string, error) {
+	if !f.Exists(dir) {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	var names []string
+	for name := range *f.fakeFs {
+		if !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+		if rest := name[len(dir)+1:]; !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeFileOpener) Exists(path string) bool {
+	for name := range *f.fakeFs {
+		if name == path || strings.HasPrefix(name, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeFileOpener) Remove(name string) error {
+	if _, found := (*f.fakeFs)[name]; !found {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(*f.fakeFs, name)
+	return nil
 }
 
 /********************************************************************************
@@ -89,14 +248,59 @@ private nullable interfaces - fileWriter
 type fileRewriter interface {
 	io.Reader
 	Close() error
-	WriteAt(b []byte, off int64) (int, error)
+	Rewrite(b []byte) error
+}
+
+type osFileRewriter struct {
+	*os.File
+	// unlock releases the lock taken by OpenFileLocked, if any
+	unlock func()
+}
+
+func (ofr *osFileRewriter) Close() error {
+	if ofr.unlock != nil {
+		ofr.unlock()
+	}
+	return ofr.File.Close()
+}
+
+func (ofr *osFileRewriter) Rewrite(b []byte) (err error) {
+	info, err := ofr.Stat()
+	if err != nil {
+		return err
+	}
+
+	name := ofr.Name()
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(b); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
 }
 
 type fakeFileRewriter struct {
 	fName  string
 	fakeFs *map[string]string
 	reader io.Reader
-	writer *bytes.Buffer
 }
 
 func (ffr *fakeFileRewriter) Read(b []byte) (n int, err error) {
@@ -108,9 +312,8 @@ func (ffr *fakeFileRewriter) Close() error {
 	return nil
 }
 
-func (ffr *fakeFileRewriter) WriteAt(b []byte, _ int64) (int, error) {
-	n, err := ffr.writer.Write(b)
-	s := ffr.writer.String()
-	(*ffr.fakeFs)[ffr.fName] = s
-	return n, err
+func (ffr *fakeFileRewriter) Rewrite(b []byte) error {
+	// Like a rename, the new contents replace the old ones all at once
+	(*ffr.fakeFs)[ffr.fName] = string(b)
+	return nil
 }
@@ -2,8 +2,13 @@ package os_file
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -58,6 +63,244 @@ new line 3
 	}
 }
 
+func Test_rewriteShorterContent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real file system")
+	}
+
+	content := `a much longer line 1
+a much longer line 2
+`
+	fPath := makeTempFile(t, "file.txt", content)
+	if err := os.Chmod(fPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fileManager := New()
+	rewriteFile(t, fileManager, fPath, "short\n")
+
+	gotBytes, _ := os.ReadFile(fPath)
+	got := string(gotBytes)
+	want := "short\n"
+	if got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+
+	info, err := os.Stat(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	entries, err := os.ReadDir(path.Dir(fPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected temp files to be cleaned up, got %v", entries)
+	}
+}
+
+func Test_nullableRewriteShorterContent(t *testing.T) {
+	content := `a much longer line 1
+a much longer line 2
+`
+	fPath := "/tmp/file.txt"
+	fakeFiles := makeFakeTempFile(fPath, content)
+
+	fileManager := NewNullable(&fakeFiles)
+	rewriteFile(t, fileManager, fPath, "short\n")
+	rewriteFile(t, fileManager, fPath, "shorter\n")
+
+	got := fakeFiles[fPath]
+	want := "shorter\n"
+	if got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func Test_openCreate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real file system")
+	}
+
+	fPath := path.Join(t.TempDir(), "new", "dir", "new.txt")
+	fileManager := New()
+	if fileManager.Exists(fPath) {
+		t.Fatal("file should not exist yet")
+	}
+	createFile(t, fileManager, fPath, "created\n")
+
+	gotBytes, _ := os.ReadFile(fPath)
+	if got, want := string(gotBytes), "created\n"; got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+	if !fileManager.Exists(fPath) || !fileManager.Exists(path.Dir(fPath)) {
+		t.Error("expected file and its directory to exist")
+	}
+
+	if err := fileManager.Remove(fPath); err != nil {
+		t.Fatal(err)
+	}
+	if fileManager.Exists(fPath) {
+		t.Error("expected file to be removed")
+	}
+}
+
+func Test_nullableOpenCreate(t *testing.T) {
+	fakeFiles := map[string]string{}
+	fPath := "/tmp/dir/new.txt"
+
+	fileManager := NewNullable(&fakeFiles)
+	if fileManager.Exists(fPath) {
+		t.Fatal("file should not exist yet")
+	}
+	createFile(t, fileManager, fPath, "created\n")
+
+	if got, want := fakeFiles[fPath], "created\n"; got != want {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, want)
+	}
+	if !fileManager.Exists(fPath) || !fileManager.Exists("/tmp/dir") {
+		t.Error("expected file and its directory to exist")
+	}
+	if fileManager.Exists("/tmp/di") {
+		t.Error("expected only whole path elements to match")
+	}
+
+	if err := fileManager.Remove(fPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := fakeFiles[fPath]; found {
+		t.Error("expected file to be removed")
+	}
+}
+
+func Test_openLocked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real file system")
+	}
+
+	fPath := path.Join(t.TempDir(), "new", "locked.txt")
+	fileManager := New()
+	appendLine := func(open func(string) (*OsFile, error), line string) error {
+		file, err := open(fPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		contents, err := file.ReadAll()
+		if err != nil {
+			return err
+		}
+		return file.Rewrite(append(contents, line+"\n"...))
+	}
+	if err := appendLine(fileManager.OpenCreateLocked, "created"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every Rewrite renames a new file into place, so waiting goroutines have
+	// to notice they locked a file that has since been replaced
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- appendLine(fileManager.OpenRWLocked, fmt.Sprintf("line %d", i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gotBytes, _ := os.ReadFile(fPath)
+	lines := strings.Split(strings.TrimSuffix(string(gotBytes), "\n"), "\n")
+	if len(lines) != writers+1 || lines[0] != "created" {
+		t.Errorf("expected every locked append to be kept, got:\n%s", gotBytes)
+	}
+}
+
+func Test_readFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real file system")
+	}
+
+	fPath := makeTempFile(t, "file.txt", "contents\n")
+	assertReadFile(t, New(), fPath, path.Join(path.Dir(fPath), "missing.txt"))
+}
+
+func Test_nullableReadFile(t *testing.T) {
+	fakeFiles := makeFakeTempFile("/tmp/file.txt", "contents\n")
+	assertReadFile(t, NewNullable(&fakeFiles), "/tmp/file.txt", "/tmp/missing.txt")
+}
+
+func assertReadFile(t *testing.T, fileManager *OsFileManager, fPath, missingPath string) {
+	t.Helper()
+	got, err := fileManager.ReadFile(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "contents\n" {
+		t.Errorf("\ngot:\n%q\nwant:\n%q", got, "contents\n")
+	}
+
+	_, err = fileManager.ReadFile(missingPath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func Test_readDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real file system")
+	}
+
+	fPath := makeTempFile(t, "b.txt", "contents\n")
+	dir := path.Dir(fPath)
+	for _, name := range []string{"a.txt", "sub/c.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertReadDir(t, New(), dir, path.Join(dir, "missing"))
+}
+
+func Test_nullableReadDir(t *testing.T) {
+	fakeFiles := map[string]string{
+		"/tmp/dir/b.txt":     "",
+		"/tmp/dir/a.txt":     "",
+		"/tmp/dir/sub/c.txt": "",
+		"/tmp/dir2/d.txt":    "",
+	}
+	assertReadDir(t, NewNullable(&fakeFiles), "/tmp/dir", "/tmp/missing")
+}
+
+func assertReadDir(t *testing.T, fileManager *OsFileManager, dir, missingDir string) {
+	t.Helper()
+	got, err := fileManager.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "a.txt,b.txt" {
+		t.Errorf("got %q, want %q", got, []string{"a.txt", "b.txt"})
+	}
+
+	_, err = fileManager.ReadDir(missingDir)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
 func makeTempFile(t *testing.T, fName, content string) string {
 	t.Helper()
 	tmpDir := t.TempDir()
@@ -99,3 +342,31 @@ func updateFile(t *testing.T, fileManager *OsFileManager, fPath string, updater
 		}
 	}
 }
+
+func rewriteFile(t *testing.T, fileManager *OsFileManager, fPath string, content string) {
+	t.Helper()
+	file, err := fileManager.OpenRW(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = file.Rewrite([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createFile(t *testing.T, fileManager *OsFileManager, fPath string, content string) {
+	t.Helper()
+	file, err := fileManager.OpenCreate(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = file.Rewrite([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
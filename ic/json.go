@@ -0,0 +1,65 @@
+package ic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// canonicalJSON parses s as a single JSON value and writes it back out in a
+// canonical form: indented by two spaces, with object keys sorted and numbers
+// written the shortest way, so that 1, 1.0 and 1e0 are all "1". Values that
+// span lines end in a newline, like other printed output.
+func canonicalJSON(s string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return "", errors.New("unexpected data after the JSON value")
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(normalizeNumbers(v)); err != nil {
+		return "", err
+	}
+	canonical := strings.TrimSuffix(buf.String(), "\n")
+	if isMultiline(canonical) {
+		canonical += "\n"
+	}
+	return canonical, nil
+}
+
+// normalizeNumbers rewrites the numbers in a value decoded with UseNumber.
+// Integers are kept exactly, while other numbers are written the way
+// encoding/json writes a float64.
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeNumbers(value)
+		}
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			return v
+		}
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			if b, err := json.Marshal(f); err == nil {
+				return json.Number(b)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,33 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_canonicalJSON(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"keys sorted", `{"b": 1, "a": [true, null]}`, "{\n  \"a\": [\n    true,\n    null\n  ],\n  \"b\": 1\n}\n"},
+		{"numbers", `[1, 1.0, 1e0, 2.50, 12345678901234567890]`, "[\n  1,\n  1,\n  1,\n  2.5,\n  12345678901234567890\n]\n"},
+		{"scalar", ` "<a&b>" `, `"<a&b>"`},
+		{"empty object", `{}`, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, got, tt.want)
+		})
+	}
+}
+
+func Test_canonicalJSON_invalid(t *testing.T) {
+	for _, in := range []string{``, `{"a": }`, `{} {}`} {
+		if got, err := canonicalJSON(in); err == nil {
+			t.Errorf("canonicalJSON(%q) = %q, want an error", in, got)
+		}
+	}
+}
@@ -13,6 +13,8 @@ type NullTester struct {
 	Failed bool
 	Exited bool
 	Output []string
+	// TestName is what Name reports, such as "TestFoo/case_a" for a subtest
+	TestName string
 }
 
 func (nt *NullTester) Reset() {
@@ -23,6 +25,10 @@ func (nt *NullTester) Reset() {
 
 // Implements ic.Tester
 
+func (nt *NullTester) Name() string {
+	return nt.TestName
+}
+
 func (nt *NullTester) Helper() {
 	// nothing to do
 }
@@ -0,0 +1,141 @@
+package ic
+
+import (
+	"strings"
+)
+
+// Placeholders that can be written in an expectation for output that changes
+// from run to run
+const (
+	// anyText matches any run of characters within a line
+	anyText = "[..]"
+	// anyLines, on a line of its own, matches any number of lines
+	anyLines = "..."
+)
+
+// maxPlaceholderCells limits the lines of want times the lines of got that
+// applyPlaceholders lines up, so that large outputs don't make it slow
+const maxPlaceholderCells = 1 << 22
+
+// hasPlaceholders reports whether the expectation want uses placeholders
+func hasPlaceholders(want string) bool {
+	if strings.Contains(want, anyText) {
+		return true
+	}
+	for _, line := range strings.Split(want, "\n") {
+		if line == anyLines {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPlaceholders returns got with the parts matched by the placeholders of
+// want replaced by the placeholders themselves. When got matches want, the
+// result is want; otherwise only the lines that really differ are left, so
+// they are all that shows in a diff, and the placeholders are kept when the
+// expectation is rewritten with the result.
+//
+// The lines of want are lined up with those of got the way that leaves the
+// fewest lines unmatched, with each "..." line taking as many lines of got as
+// suits the lines after it.
+func applyPlaceholders(want, got string) string {
+	if !hasPlaceholders(want) {
+		return got
+	}
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	n, m := len(wantLines), len(gotLines)
+	if (n+1)*(m+1) > maxPlaceholderCells {
+		return got
+	}
+
+	// cost[i*(m+1)+j] is how many lines are left unmatched lining up
+	// wantLines[i:] with gotLines[j:], with a line that changed counting once
+	stride := m + 1
+	cost := make([]int32, (n+1)*stride)
+	at := func(i, j int) int32 { return cost[i*stride+j] }
+	for j := m; j >= 0; j-- {
+		cost[n*stride+j] = int32(m - j)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m; j >= 0; j-- {
+			var c int32
+			switch {
+			case wantLines[i] == anyLines:
+				c = at(i+1, j)
+				if j < m && at(i, j+1) < c {
+					c = at(i, j+1)
+				}
+			default:
+				c = at(i+1, j) + 1
+				if j < m {
+					if at(i, j+1)+1 < c {
+						c = at(i, j+1) + 1
+					}
+					if at(i+1, j+1)+1 < c {
+						c = at(i+1, j+1) + 1
+					}
+					if matchesLine(wantLines[i], gotLines[j]) && at(i+1, j+1) < c {
+						c = at(i+1, j+1)
+					}
+				}
+			}
+			cost[i*stride+j] = c
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < n || j < m {
+		c := at(i, j)
+		switch {
+		case i < n && wantLines[i] == anyLines:
+			// Lines are only taken when that does better than leaving
+			// them to the lines after, so a changed line shows as one
+			if at(i+1, j) != c {
+				j++
+				continue
+			}
+			lines = append(lines, anyLines)
+			i++
+		case i < n && j < m && matchesLine(wantLines[i], gotLines[j]) && at(i+1, j+1) == c:
+			lines = append(lines, wantLines[i])
+			i++
+			j++
+		case i < n && j < m && at(i+1, j+1)+1 == c:
+			// The line changed
+			lines = append(lines, gotLines[j])
+			i++
+			j++
+		case j < m && at(i, j+1)+1 == c:
+			lines = append(lines, gotLines[j])
+			j++
+		default:
+			// The line of want is missing from got
+			i++
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// matchesLine reports whether line matches pattern, in which each "[..]"
+// stands for any run of characters
+func matchesLine(pattern, line string) bool {
+	parts := strings.Split(pattern, anyText)
+	if len(parts) == 1 {
+		return pattern == line
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	if len(line) < len(first)+len(last) || !strings.HasPrefix(line, first) || !strings.HasSuffix(line, last) {
+		return false
+	}
+	line = line[len(first) : len(line)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		k := strings.Index(line, part)
+		if k == -1 {
+			return false
+		}
+		line = line[k+len(part):]
+	}
+	return true
+}
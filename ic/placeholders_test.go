@@ -0,0 +1,48 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_matchesLine(t *testing.T) {
+	tests := []struct {
+		pattern, line string
+		want          bool
+	}{
+		{"plain", "plain", true},
+		{"plain", "plainer", false},
+		{"took [..]ms", "took 12ms", true},
+		{"took [..]ms", "took ms", true},
+		{"took [..]ms", "took 12s", false},
+		{"[..]", "anything", true},
+		{"a[..]b[..]c", "a1b2b3c", true},
+		{"a[..]b[..]c", "a1c", false},
+		{"ab[..]ba", "aba", false},
+	}
+	for _, tt := range tests {
+		if got := matchesLine(tt.pattern, tt.line); got != tt.want {
+			t.Errorf("matchesLine(%q, %q) = %v, want %v", tt.pattern, tt.line, got, tt.want)
+		}
+	}
+}
+
+func Test_applyPlaceholders(t *testing.T) {
+	tests := []struct {
+		name, want, got, wantResult string
+	}{
+		{"no placeholders", "a\nb", "a\nc", "a\nc"},
+		{"text matches", "id: [..]\nok", "id: 42\nok", "id: [..]\nok"},
+		{"lines match", "start\n...\nend", "start\n1\n2\nend", "start\n...\nend"},
+		{"no lines match", "start\n...\nend", "start\nend", "start\n...\nend"},
+		{"trailing lines", "start\n...", "start\n1\n2", "start\n..."},
+		{"only differences left", "id: [..]\n...\nend: ok", "id: 7\n1\n2\nend: failed", "id: [..]\n...\nend: failed"},
+		{"extra line kept", "a: [..]\nb", "a: 1\nextra\nb", "a: [..]\nextra\nb"},
+		{"missing line dropped", "a: [..]\nb\nc", "a: 1\nc", "a: [..]\nc"},
+		{"lines take what suits the rest", "...\nb: [..]", "b: 1\nb: 2", "...\nb: [..]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, applyPlaceholders(tt.want, tt.got), tt.wantResult)
+		})
+	}
+}
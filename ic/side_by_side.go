@@ -0,0 +1,104 @@
+package ic
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/diff"
+)
+
+// minSideBySideColumn is the narrowest a column of a side by side diff gets,
+// however small the width asked for
+const minSideBySideColumn = 10
+
+// SideBySideDiff returns a Differ showing got and want next to each other, in
+// two columns fitting in width characters, with context unchanged lines
+// around each change. Columns stay lined up, which makes changes to tables
+// easier to follow than in a unified diff. The gutter between the columns
+// marks changed lines with "|", lines only in got with "<" and lines only in
+// want with ">". Lines too long for their column wrap onto the next row.
+func SideBySideDiff(width, context int) Differ {
+	return sideBySideDiffer{width: width, context: context}
+}
+
+type sideBySideDiffer struct {
+	width, context int
+}
+
+func (s sideBySideDiffer) Diff(got, want string) string {
+	gotLines, wantLines := diffLines(got), diffLines(want)
+	column := (s.width - 3) / 2
+	if column < minSideBySideColumn {
+		column = minSideBySideColumn
+	}
+
+	var sb strings.Builder
+	row := func(left string, gutter byte, right string) {
+		leftRows, rightRows := wrapColumn(left, column), wrapColumn(right, column)
+		for k := 0; k < len(leftRows) || k < len(rightRows); k++ {
+			var l, r string
+			if k < len(leftRows) {
+				l = leftRows[k]
+			}
+			if k < len(rightRows) {
+				r = rightRows[k]
+			}
+			pad := strings.Repeat(" ", column-utf8.RuneCountInString(l))
+			sb.WriteString(strings.TrimRight(fmt.Sprintf("%s%s %c %s", l, pad, gutter, r), " ") + "\n")
+		}
+	}
+	for _, group := range diff.GroupOpCodes(diff.Myers(gotLines, wantLines), s.context) {
+		first := group[0]
+		row(fmt.Sprintf("Got line %d", first.I1+1), ' ', fmt.Sprintf("Want line %d", first.J1+1))
+		for _, op := range group {
+			left, right := gotLines[op.I1:op.I2], wantLines[op.J1:op.J2]
+			for k := 0; k < len(left) || k < len(right); k++ {
+				switch {
+				case op.Tag == 'e':
+					row(sideBySideText(left[k]), ' ', sideBySideText(right[k]))
+				case k < len(left) && k < len(right):
+					row(sideBySideText(left[k]), '|', sideBySideText(right[k]))
+				case k < len(left):
+					row(sideBySideText(left[k]), '<', "")
+				default:
+					row("", '>', sideBySideText(right[k]))
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// sideBySideText drops the newline of line and expands its tabs, which
+// would otherwise throw the columns out of line
+func sideBySideText(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := 8 - n%8
+			sb.WriteString(strings.Repeat(" ", spaces))
+			n += spaces
+			continue
+		}
+		sb.WriteRune(r)
+		n++
+	}
+	return sb.String()
+}
+
+// wrapColumn splits s into rows of at most width characters
+func wrapColumn(s string, width int) []string {
+	runes := []rune(s)
+	var rows []string
+	for len(runes) > width {
+		rows = append(rows, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(rows, string(runes))
+}
@@ -0,0 +1,56 @@
+package ic
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_sideBySideDiffer(t *testing.T) {
+	got := "a\nb\nlong line here\nc"
+	want := "a\nB\nlong line HERE\nc\nd"
+	wantDiff := "" +
+		"Got line 1    Want line 1\n" +
+		"a             a\n" +
+		"b           | B\n" +
+		"long line h | long line H\n" +
+		"ere         | ERE\n" +
+		"c             c\n" +
+		"            > d\n"
+	assertEqual(t, SideBySideDiff(25, 3).Diff(got, want), wantDiff)
+	assertEqual(t, SideBySideDiff(25, 3).Diff(got, got), "")
+}
+
+func Test_sideBySideText(t *testing.T) {
+	assertEqual(t, sideBySideText("a\tb\n"), "a       b")
+	assertEqual(t, sideBySideText("plain"), "plain")
+}
+
+func Test_wrapColumn(t *testing.T) {
+	got := wrapColumn("abcdefg", 3)
+	want := []string{"abc", "def", "g"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func Test_differForStyle(t *testing.T) {
+	tests := []struct {
+		style string
+		want  Differ
+	}{
+		{"", defaultDiffer},
+		{"myers", MyersDiff(3)},
+		{"patience", PatienceDiff(3)},
+		{"side-by-side", SideBySideDiff(defaultSideBySideWidth, 3)},
+		{"side-by-side:80", SideBySideDiff(80, 3)},
+		{"unknown", defaultDiffer},
+	}
+	for _, tt := range tests {
+		// Differs hold funcs, which only compare by the printed pointer
+		got, want := fmt.Sprintf("%#v", differForStyle(tt.style)), fmt.Sprintf("%#v", tt.want)
+		if got != want {
+			t.Errorf("differForStyle(%q) = %s, want %s", tt.style, got, want)
+		}
+	}
+}
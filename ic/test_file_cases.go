@@ -0,0 +1,303 @@
+package ic
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// resolveCaseField returns the string literal held by a field of a table test
+// case, such as tt.want in
+//
+//	for _, tt := range tests {
+//		t.Run(tt.name, func(t *testing.T) { c.Expect(tt.want) })
+//	}
+//
+// The running case is found from the name passed to t.Run in the loop: a
+// field of the case, the key of a map entry or the index of the case, which
+// is then matched against the last element of testName. Tables can be
+// slices, arrays or maps of structs.
+func resolveCaseField(f *ast.File, sel *ast.SelectorExpr, testName string) (ast.Expr, error) {
+	caseIdent, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a string literal", exprString(sel))
+	}
+	if caseIdent.Obj == nil {
+		return nil, fmt.Errorf("%s is not declared in this file", exprString(sel))
+	}
+	loop := rangeLoop(f, caseIdent)
+	if loop == nil {
+		return nil, fmt.Errorf("%s is not a field of a test case from ranging over a table", exprString(sel))
+	}
+
+	rangeX := unparen(loop.X)
+	table, ok := rangeX.(*ast.CompositeLit)
+	if ident, isIdent := rangeX.(*ast.Ident); isIdent {
+		value, err := resolveDecl(f, ident)
+		if err != nil {
+			return nil, err
+		}
+		table, ok = value.(*ast.CompositeLit)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not ranging over a table declared in this file", caseIdent.Name)
+	}
+
+	lastSlash := strings.LastIndex(testName, "/")
+	if lastSlash == -1 {
+		return nil, fmt.Errorf("%s is not a subtest, so the running case of the table can't be found", testName)
+	}
+	source, err := subtestNameSource(loop, caseIdent, sel.Pos())
+	if err != nil {
+		return nil, err
+	}
+	elt, err := runningCase(table, source, testName[lastSlash+1:])
+	if err != nil {
+		return nil, err
+	}
+	value := caseField(table, elt, sel.Sel.Name)
+	if value == nil {
+		return nil, fmt.Errorf("the running case of %s doesn't set %s", caseIdent.Name, sel.Sel.Name)
+	}
+	if _, isString := stringValue(value); !isString {
+		return nil, fmt.Errorf("%s in the running case is not a string literal", exprString(sel))
+	}
+	return value, nil
+}
+
+// rangeLoop returns the range statement declaring ident as its value
+func rangeLoop(f *ast.File, ident *ast.Ident) *ast.RangeStmt {
+	var loop *ast.RangeStmt
+	ast.Inspect(f, func(n ast.Node) bool {
+		if rs, ok := n.(*ast.RangeStmt); ok {
+			if value, ok := rs.Value.(*ast.Ident); ok && value.Obj == ident.Obj {
+				loop = rs
+			}
+		}
+		return loop == nil
+	})
+	return loop
+}
+
+// caseNameSource says where the subtests of a table get their names
+type caseNameSource struct {
+	// field is the field of the case holding the name, "" when it is the
+	// key of a map entry, unless byIndex is set
+	field string
+	// byIndex is set when subtests are named after the index of their case
+	byIndex bool
+}
+
+// subtestNameSource finds the t.Run call in loop that runs the code at pos,
+// or the only one in loop, and works out where the name given to it comes
+// from
+func subtestNameSource(loop *ast.RangeStmt, caseIdent *ast.Ident, pos token.Pos) (caseNameSource, error) {
+	var runs []*ast.CallExpr
+	var enclosing *ast.CallExpr
+	ast.Inspect(loop.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		if fun, ok := call.Fun.(*ast.SelectorExpr); !ok || fun.Sel.Name != "Run" {
+			return true
+		}
+		runs = append(runs, call)
+		if call.Args[1].Pos() <= pos && pos < call.Args[1].End() {
+			// Later matches are nested, so closer to pos
+			enclosing = call
+		}
+		return true
+	})
+	if enclosing == nil {
+		if len(runs) != 1 {
+			return caseNameSource{}, fmt.Errorf("no t.Run call in the loop over the table runs %s, so the running case can't be found", caseIdent.Name)
+		}
+		enclosing = runs[0]
+	}
+
+	var key *ast.Ident
+	if ident, ok := loop.Key.(*ast.Ident); ok && ident.Name != "_" {
+		key = ident
+	}
+	isKey := func(e ast.Expr) bool {
+		ident, ok := unparen(e).(*ast.Ident)
+		return ok && key != nil && ident.Obj == key.Obj
+	}
+	switch name := unparen(enclosing.Args[0]).(type) {
+	case *ast.SelectorExpr:
+		if x, ok := name.X.(*ast.Ident); ok && x.Obj == caseIdent.Obj {
+			return caseNameSource{field: name.Sel.Name}, nil
+		}
+	case *ast.Ident:
+		if isKey(name) {
+			return caseNameSource{}, nil
+		}
+	case *ast.CallExpr:
+		// Such as fmt.Sprint(i) or strconv.Itoa(i)
+		for _, arg := range name.Args {
+			if isKey(arg) {
+				return caseNameSource{byIndex: true}, nil
+			}
+		}
+	}
+	return caseNameSource{}, fmt.Errorf("the name given to t.Run isn't a field of %s, a map key or an index, so the running case can't be found", caseIdent.Name)
+}
+
+// runningCase returns the element of table run as subtest, whose name comes
+// from source. It fails unless exactly one case matches.
+func runningCase(table *ast.CompositeLit, source caseNameSource, subtest string) (*ast.CompositeLit, error) {
+	var matches []*ast.CompositeLit
+	for i, elt := range table.Elts {
+		var name string
+		var hasName bool
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if source.field == "" && !source.byIndex {
+				name, hasName = stringValue(kv.Key)
+			}
+			elt = kv.Value
+		}
+		if unary, ok := elt.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			elt = unary.X
+		}
+		lit, ok := elt.(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf("the cases of the table aren't all composite literals")
+		}
+		switch {
+		case source.byIndex:
+			name, hasName = strconv.Itoa(i), true
+		case source.field != "":
+			name, hasName = stringValue(caseField(table, lit, source.field))
+		}
+		if hasName && subtestName(name) == subtest {
+			matches = append(matches, lit)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no case of the table is named %q, so the running case can't be found", subtest)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%d cases of the table are named %q, so the running case can't be told apart", len(matches), subtest)
+}
+
+// subtestName returns the name the testing package gives a subtest run with
+// t.Run(name, ...)
+func subtestName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			sb.WriteByte('_')
+		case !strconv.IsPrint(r):
+			quoted := strconv.QuoteRune(r)
+			sb.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// caseField returns the value given to the field name in the case elt of table
+func caseField(table, elt *ast.CompositeLit, name string) ast.Expr {
+	for i, field := range elt.Elts {
+		if caseFieldName(table, elt, i) == name {
+			return caseFieldValue(field)
+		}
+	}
+	return nil
+}
+
+// caseFieldName returns the name of the ith field set in the case elt of
+// table. Unkeyed fields are named by their position in the struct when it is
+// declared in the same file, and by their index when it isn't.
+func caseFieldName(table, elt *ast.CompositeLit, i int) string {
+	if kv, ok := elt.Elts[i].(*ast.KeyValueExpr); ok {
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			return key.Name
+		}
+	}
+	if st := caseStruct(table, elt); st != nil {
+		if name := structFieldName(st, i); name != "" {
+			return name
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+func caseFieldValue(field ast.Expr) ast.Expr {
+	if kv, ok := field.(*ast.KeyValueExpr); ok {
+		return kv.Value
+	}
+	return field
+}
+
+// caseStruct returns the struct type of the cases of table, if it is
+// declared in the same file
+func caseStruct(table, elt *ast.CompositeLit) *ast.StructType {
+	typ := elt.Type
+	if typ == nil {
+		switch tableType := table.Type.(type) {
+		case *ast.ArrayType:
+			typ = tableType.Elt
+		case *ast.MapType:
+			typ = tableType.Value
+		}
+	}
+	for typ != nil {
+		switch t := typ.(type) {
+		case *ast.StructType:
+			return t
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.Ident:
+			if t.Obj == nil {
+				return nil
+			}
+			spec, ok := t.Obj.Decl.(*ast.TypeSpec)
+			if !ok {
+				return nil
+			}
+			typ = spec.Type
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// structFieldName returns the name of the ith field of st, or "" for an
+// embedded field
+func structFieldName(st *ast.StructType, i int) string {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			if i == 0 {
+				return ""
+			}
+			i--
+			continue
+		}
+		if i < len(field.Names) {
+			return field.Names[i].Name
+		}
+		i -= len(field.Names)
+	}
+	return ""
+}
+
+// exprString formats simple expressions such as tt.want for error messages
+func exprString(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	}
+	return "expression"
+}
@@ -0,0 +1,223 @@
+package ic
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"sync"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/diff"
+)
+
+// textEdit replaces the expectation literal in [start, end) with one for got
+type textEdit struct {
+	start, end int
+	got        string
+}
+
+// testFileEdits queues every edit made to each test file during a test run.
+// Edits are stored against the file as it was when first read, which is what
+// the line numbers from runtime.Caller refer to, so later edits still land in
+// the right place no matter how many came before them.
+type testFileEdits struct {
+	mu    sync.Mutex
+	files map[string]*editedFile
+}
+
+type editedFile struct {
+	original []byte
+	edits    []textEdit
+}
+
+var globalTestFileEdits = newTestFileEdits()
+
+func newTestFileEdits() *testFileEdits {
+	return &testFileEdits{files: make(map[string]*editedFile)}
+}
+
+// original returns the contents of fName from before any edits were made.
+// read is only called the first time fName is seen.
+func (tfe *testFileEdits) original(fName string, read func() ([]byte, error)) ([]byte, error) {
+	tfe.mu.Lock()
+	defer tfe.mu.Unlock()
+
+	ef, found := tfe.files[fName]
+	if !found {
+		original, err := read()
+		if err != nil {
+			return nil, err
+		}
+		ef = &editedFile{original: original}
+		tfe.files[fName] = ef
+	}
+	return ef.original, nil
+}
+
+// add records an edit made against the original contents of fName and
+// returns the updated, gofmt-ed contents with every edit so far applied. An
+// edit that can't be applied is not kept.
+func (tfe *testFileEdits) add(fName string, e textEdit) ([]byte, error) {
+	tfe.mu.Lock()
+	defer tfe.mu.Unlock()
+
+	ef, found := tfe.files[fName]
+	if !found {
+		return nil, fmt.Errorf("%s was edited before it was read", fName)
+	}
+	for _, prev := range ef.edits {
+		if e.start < prev.end && prev.start < e.end {
+			return nil, errAlreadyUpdated
+		}
+	}
+	edits := append(append([]textEdit{}, ef.edits...), e)
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+
+	updated, err := renderEdits(fName, ef.original, edits)
+	if err != nil {
+		return nil, err
+	}
+	ef.edits = edits
+	return updated, nil
+}
+
+// applyEdits returns a copy of src with the sorted, non-overlapping edits
+// applied. text returns the replacement for the i-th edit.
+func applyEdits(src []byte, edits []textEdit, text func(i int) string) []byte {
+	var sb bytes.Buffer
+	last := 0
+	for i, e := range edits {
+		sb.Write(src[last:e.start])
+		sb.WriteString(text(i))
+		last = e.end
+	}
+	sb.Write(src[last:])
+	return sb.Bytes()
+}
+
+// rebaseEdit moves an edit made against original so that it applies to
+// current instead. The file changes underneath an edit when other tests, in
+// this process or another, update it first, and the first update to a file
+// that isn't gofmt-clean formats all of it. The literals holding the edit
+// must not have changed.
+func rebaseEdit(fName string, original, current []byte, e textEdit) (textEdit, error) {
+	if bytes.Equal(original, current) {
+		return e, nil
+	}
+	if rebased, ok := rebaseLiterals(fName, original, current, e); ok {
+		return rebased, nil
+	}
+	if rebased, ok := rebaseLines(original, current, e); ok {
+		return rebased, nil
+	}
+	if formatted, formattedEdit, ok := gofmtEdit(fName, original, e); ok {
+		if rebased, ok := rebaseLines(formatted, current, formattedEdit); ok {
+			return rebased, nil
+		}
+	}
+	firstLine := bytes.Count(original[:e.start], []byte("\n"))
+	return textEdit{}, fmt.Errorf("the expectation at %s:%d was changed by someone else during this run", fName, firstLine+1)
+}
+
+// rebaseLiterals moves e from original to current by counting string
+// literals, which neither gofmt nor updates to other expectations add or
+// remove. It only succeeds when both files have as many literals and the ones
+// e covers are unchanged.
+func rebaseLiterals(fName string, original, current []byte, e textEdit) (textEdit, bool) {
+	before, err := literalSpans(fName, original)
+	if err != nil {
+		return textEdit{}, false
+	}
+	after, err := literalSpans(fName, current)
+	if err != nil || len(before) != len(after) {
+		return textEdit{}, false
+	}
+	first, last, ok := coveredLiterals(before, e)
+	if !ok {
+		return textEdit{}, false
+	}
+	for i := first; i <= last; i++ {
+		if !bytes.Equal(original[before[i][0]:before[i][1]], current[after[i][0]:after[i][1]]) {
+			return textEdit{}, false
+		}
+	}
+	return textEdit{start: after[first][0], end: after[last][1], got: e.got}, true
+}
+
+// rebaseLines moves e from original to current when the lines holding it are
+// the same in both
+func rebaseLines(original, current []byte, e textEdit) (textEdit, bool) {
+	originalLines := splitLines(string(original))
+	currentLines := splitLines(string(current))
+	firstLine := bytes.Count(original[:e.start], []byte("\n"))
+	lastLine := bytes.Count(original[:e.end], []byte("\n"))
+
+	for _, op := range diff.Myers(originalLines, currentLines) {
+		if op.Tag != 'e' || firstLine < op.I1 || lastLine >= op.I2 {
+			continue
+		}
+		shift := lineOffset(currentLines, op.J1+firstLine-op.I1) - lineOffset(originalLines, firstLine)
+		return textEdit{start: e.start + shift, end: e.end + shift, got: e.got}, true
+	}
+	return textEdit{}, false
+}
+
+// gofmtEdit runs src through gofmt and moves e, made against src, onto the
+// result. It returns false when src is already formatted or can't be.
+func gofmtEdit(fName string, src []byte, e textEdit) ([]byte, textEdit, bool) {
+	formatted, err := format.Source(src)
+	if err != nil || bytes.Equal(formatted, src) {
+		return nil, textEdit{}, false
+	}
+	rebased, ok := rebaseLiterals(fName, src, formatted, e)
+	return formatted, rebased, ok
+}
+
+// coveredLiterals returns the indexes of the first and last of spans that e
+// replaces, which must start and end where e does
+func coveredLiterals(spans [][2]int, e textEdit) (first, last int, ok bool) {
+	first, last = -1, -1
+	for i, span := range spans {
+		if span[0] >= e.start && span[1] <= e.end {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 || spans[first][0] != e.start || spans[last][1] != e.end {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// literalSpans returns the offsets of every string literal in src, in order
+func literalSpans(fName string, src []byte) ([][2]int, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fName, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	var spans [][2]int
+	ast.Inspect(f, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			spans = append(spans, [2]int{fset.Position(lit.Pos()).Offset, fset.Position(lit.End()).Offset})
+		}
+		return true
+	})
+	return spans, nil
+}
+
+// lineOffset returns the offset of the start of the nth line
+func lineOffset(lines []string, n int) int {
+	offset := 0
+	for _, line := range lines[:n] {
+		offset += len(line)
+	}
+	return offset
+}
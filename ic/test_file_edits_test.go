@@ -0,0 +1,123 @@
+package ic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_testFileEdits(t *testing.T) {
+	tfe := newTestFileEdits()
+	reads := 0
+	read := func() ([]byte, error) {
+		reads++
+		return []byte("package p\n\nvar a, b = \"\", \"\"\n"), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		original, err := tfe.original("foo_test.go", read)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(original), "package p\n\nvar a, b = \"\", \"\"\n")
+	}
+
+	got, err := tfe.add("foo_test.go", textEdit{26, 28, "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(got), "package p\n\nvar a, b = \"\", `B`\n")
+
+	// Offsets are relative to the original contents, not the updated ones
+	got, err = tfe.add("foo_test.go", textEdit{22, 24, "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(got), "package p\n\nvar a, b = `A`, `B`\n")
+
+	_, err = tfe.add("foo_test.go", textEdit{26, 28, "again"})
+	if !errors.Is(err, errAlreadyUpdated) {
+		t.Errorf("got error %v, want %v", err, errAlreadyUpdated)
+	}
+
+	if _, err = tfe.add("bar_test.go", textEdit{0, 0, "unread"}); err == nil {
+		t.Error("expected an error editing a file that was never read")
+	}
+
+	if reads != 1 {
+		t.Errorf("got %d reads, want 1", reads)
+	}
+}
+
+func Test_rebaseEdit(t *testing.T) {
+	original := "package p\n\nfunc TestFoo(t *testing.T) {\n\tc.Expect(\"\")\n}\n"
+	start := strings.Index(original, `""`)
+	e := textEdit{start, start + 2, "foo"}
+
+	t.Run("unchanged", func(t *testing.T) {
+		got, err := rebaseEdit("foo_test.go", []byte(original), []byte(original), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e {
+			t.Errorf("got %#v, want %#v", got, e)
+		}
+	})
+
+	t.Run("lines added above", func(t *testing.T) {
+		current := strings.Replace(original, "func TestFoo", "func TestBar(t *testing.T) {\n\tc.Expect(`\n\t\tbar\n\t\tbaz`)\n}\n\nfunc TestFoo", 1)
+		got, err := rebaseEdit("foo_test.go", []byte(original), []byte(current), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, current[got.start:got.end], `""`)
+		assertEqual(t, got.got, "foo")
+	})
+
+	t.Run("file formatted by an earlier update", func(t *testing.T) {
+		// Space indented, as gofmt would never leave it
+		unformatted := "package p\n\nfunc TestFoo(t *testing.T) {\n    c.Expect(\"\")\n    c.Expect(\"\")\n}\n"
+		first := strings.Index(unformatted, `""`)
+		second := strings.LastIndex(unformatted, `""`)
+		current, err := renderEdits("foo_test.go", []byte(unformatted), []textEdit{{first, first + 2, "a\nb"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := rebaseEdit("foo_test.go", []byte(unformatted), current, textEdit{second, second + 2, "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(current[got.start:got.end]), `""`)
+		updated, err := renderEdits("foo_test.go", current, []textEdit{got})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(updated), "package p\n\nfunc TestFoo(t *testing.T) {\n\tc.Expect(`\n\t\ta\n\t\tb`)\n\tc.Expect(`c`)\n}\n")
+	})
+
+	t.Run("concatenation updated in an unformatted file", func(t *testing.T) {
+		unformatted := "package p\n\nfunc TestFoo(t *testing.T) {\n    c.Expect(\"a\" + \"b\")\n    c.Expect(\"\")\n}\n"
+		first := strings.Index(unformatted, `"a"`)
+		second := strings.LastIndex(unformatted, `""`)
+		current, err := renderEdits("foo_test.go", []byte(unformatted), []textEdit{{first, first + len(`"a" + "b"`), "ab"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := rebaseEdit("foo_test.go", []byte(unformatted), current, textEdit{second, second + 2, "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(current[got.start:got.end]), `""`)
+	})
+
+	t.Run("expectation changed", func(t *testing.T) {
+		current := strings.Replace(original, `""`, "`bar`", 1)
+		_, err := rebaseEdit("foo_test.go", []byte(original), []byte(current), e)
+		wantErr := "the expectation at foo_test.go:4 was changed by someone else during this run"
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+	})
+}
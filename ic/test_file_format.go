@@ -0,0 +1,98 @@
+package ic
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+)
+
+// renderEdits applies edits to src and runs the result through gofmt. Every
+// expectation is first written as a placeholder so that multiline expectations
+// can be indented to match the formatted code around them.
+func renderEdits(fName string, src []byte, edits []textEdit) ([]byte, error) {
+	placeholders := make([]string, len(edits))
+	for i := range edits {
+		placeholders[i] = fmt.Sprintf(`"ic-placeholder-%d"`, i)
+	}
+	withPlaceholders := applyEdits(src, edits, func(i int) string {
+		return placeholders[i]
+	})
+	formatted, err := gofmt(fName, withPlaceholders)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb bytes.Buffer
+	last := 0
+	for i, e := range edits {
+		idx := bytes.Index(formatted[last:], []byte(placeholders[i]))
+		if idx == -1 {
+			return nil, fmt.Errorf("lost track of an expectation while formatting %s", fName)
+		}
+		idx += last
+		literal, err := expectationLiteral(e.got, lineIndent(formatted, idx))
+		if err != nil {
+			return nil, err
+		}
+		sb.Write(formatted[last:idx])
+		sb.WriteString(literal)
+		last = idx + len(placeholders[i])
+	}
+	sb.Write(formatted[last:])
+
+	// Multiline expectations can change how gofmt aligns the code around them
+	return gofmt(fName, sb.Bytes())
+}
+
+// gofmt formats src, making sure the contents of every string literal are
+// left alone
+func gofmt(fName string, src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("unable to gofmt %s after update: %w", fName, err)
+	}
+
+	before, err := stringLiterals(fName, src)
+	if err != nil {
+		return nil, err
+	}
+	after, err := stringLiterals(fName, formatted)
+	if err != nil {
+		return nil, err
+	}
+	if len(before) != len(after) {
+		return nil, fmt.Errorf("gofmt changed the string literals in %s", fName)
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			return nil, fmt.Errorf("gofmt changed the string literal %s in %s", before[i], fName)
+		}
+	}
+	return formatted, nil
+}
+
+// stringLiterals returns every string literal in src, in order
+func stringLiterals(fName string, src []byte) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), fName, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", fName, err)
+	}
+	var literals []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			literals = append(literals, lit.Value)
+		}
+		return true
+	})
+	return literals, nil
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(src []byte, offset int) string {
+	lineStart := bytes.LastIndexByte(src[:offset], '\n') + 1
+	line := src[lineStart:offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
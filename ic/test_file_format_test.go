@@ -0,0 +1,52 @@
+package ic
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_renderEdits(t *testing.T) {
+	t.Run("space indented file", func(t *testing.T) {
+		src := "package p\n\nfunc TestFoo(t *testing.T) {\n    if true {\n        c.Expect(``)\n    }\n}\n"
+		start := strings.Index(src, "``")
+		got, err := renderEdits("foo_test.go", []byte(src), []textEdit{{start, start + 2, "foo\nbar"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "package p\n\nfunc TestFoo(t *testing.T) {\n\tif true {\n\t\tc.Expect(`\n\t\t\tfoo\n\t\t\tbar`)\n\t}\n}\n"
+		assertEqual(t, string(got), want)
+	})
+	t.Run("aligned composite literal", func(t *testing.T) {
+		src := `package p
+
+var tests = []struct{ name, want string }{
+	{name: "a", want: ""},
+	{name: "b", want: ""},
+}
+`
+		start := strings.Index(src, `""`)
+		got, err := renderEdits("foo_test.go", []byte(src), []textEdit{{start, start + 2, "foo\nbar"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `package p
+
+var tests = []struct{ name, want string }{
+	{name: "a", want: ` + "`" + `
+		foo
+		bar` + "`" + `},
+	{name: "b", want: ""},
+}
+`
+		assertEqual(t, string(got), want)
+	})
+	t.Run("file cannot be formatted", func(t *testing.T) {
+		src := "package p\n\nvar a = \"\"\nfunc {\n"
+		start := strings.Index(src, `""`)
+		_, err := renderEdits("foo_test.go", []byte(src), []textEdit{{start, start + 2, "foo"}})
+		wantErr := "unable to gofmt foo_test.go after update"
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("got error %v, want it to contain %q", err, wantErr)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package ic
+
+import (
+	"path/filepath"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/infra/cmd"
+)
+
+// readGolden returns the contents of the golden file at path
+func (d TestFileUpdater) readGolden(path string) ([]byte, error) {
+	return d.osFileManager.ReadFile(path)
+}
+
+// UpdateGolden replaces the contents of the golden file at path with got,
+// creating it when original is nil
+func (d TestFileUpdater) UpdateGolden(ic *IC, path string, original []byte, got string) {
+	ic.t.Helper()
+
+	switch d.cmd.UpdateMode() {
+	case cmd.UpdatePending:
+		ic.t.Logf("IC: pending snapshots are not supported for golden files. Use IC_UPDATE=all or IC_UPDATE=patch:<file> to update %s", path)
+		return
+	case cmd.UpdatePatch:
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			ic.t.Logf("IC: error finding golden file %s: %s", path, err)
+			ic.t.FailNow()
+			return
+		}
+		patchPath, err := d.writePatch(absPath, original, []byte(got))
+		if err != nil {
+			ic.t.Logf("IC: error writing patch %s: %s", patchPath, err)
+			ic.t.FailNow()
+			return
+		}
+		ic.t.Logf("IC: Recorded update in patch %s", patchPath)
+		return
+	}
+
+	goldenFile, err := d.osFileManager.OpenCreateLocked(path)
+	if err != nil {
+		ic.t.Logf("IC: error opening golden file %s: %s", path, err)
+		ic.t.FailNow()
+		return
+	}
+	defer goldenFile.Close()
+
+	ic.t.Logf("IC: Updating golden file %s. Rerun tests to verify", path)
+	if err = goldenFile.Rewrite([]byte(got)); err != nil {
+		ic.t.Logf("IC: error writing golden file %s: %s", path, err)
+		ic.t.FailNow()
+	}
+}
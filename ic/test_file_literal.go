@@ -0,0 +1,138 @@
+package ic
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expectationLiteral returns the most readable Go expression that, once
+// evaluated and trimmed the way Expect trims its expectation, is exactly got.
+// Multiline values start on their own line and are indented one level past
+// indent.
+func expectationLiteral(got string, indent string) (string, error) {
+	for _, literal := range literalCandidates(got, indent) {
+		if literalRoundTrips(literal, got) {
+			return literal, nil
+		}
+	}
+	return "", fmt.Errorf("no Go string literal can hold %q as an expectation", got)
+}
+
+// literalCandidates returns the ways of writing got as an expectation, best first
+func literalCandidates(got string, indent string) []string {
+	if !isMultiline(got) {
+		if canBeRaw(got) && !strings.Contains(got, "`") {
+			return []string{"`" + got + "`"}
+		}
+		return []string{strconv.Quote(got)}
+	}
+
+	var candidates []string
+	if canBeRaw(got) {
+		candidates = append(candidates, rawBlock(got, indent))
+	}
+	// trim drops a leading newline, so one is added to keep a real one
+	return append(candidates, strconv.Quote(got), strconv.Quote("\n"+got))
+}
+
+// rawBlock formats multiline got as a raw string starting on its own line.
+// Backquotes can't appear in a raw string, so they are spliced in as
+// interpreted strings.
+func rawBlock(got string, indent string) string {
+	text := "\n" + got
+	if len(indent) > 0 {
+		prefix := indent + "\t"
+		text = "\n" + prefix + strings.ReplaceAll(got, "\n", "\n"+prefix)
+	}
+
+	var parts []string
+	for text != "" {
+		i := strings.IndexByte(text, '`')
+		if i == -1 {
+			parts = append(parts, "`"+text+"`")
+			break
+		}
+		if i > 0 {
+			parts = append(parts, "`"+text[:i]+"`")
+		}
+		n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+		parts = append(parts, strconv.Quote(text[i:i+n]))
+		text = text[i+n:]
+	}
+	return strings.Join(parts, " + ")
+}
+
+// canBeRaw reports whether s can be written as a raw string without hiding
+// anything from the reader. Raw strings drop carriage returns, and the
+// compiler rejects NUL bytes and invalid UTF-8.
+func canBeRaw(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// literalRoundTrips reports whether the expectation literal matches got
+func literalRoundTrips(literal string, got string) bool {
+	expr, err := parser.ParseExpr(literal)
+	if err != nil {
+		return false
+	}
+	value, ok := stringValue(expr)
+	return ok && trim(value) == got
+}
+
+// stringValue evaluates e if it is a string literal, or a concatenation of
+// string literals
+func stringValue(e ast.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		value, err := strconv.Unquote(e.Value)
+		return value, err == nil
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := stringValue(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := stringValue(e.Y)
+		return x + y, ok
+	case *ast.ParenExpr:
+		return stringValue(e.X)
+	}
+	return "", false
+}
+
+// stringExprs returns every string literal in f, in order, treating a
+// concatenation of string literals as one
+func stringExprs(f *ast.File) []ast.Expr {
+	var exprs []ast.Expr
+	ast.Inspect(f, func(n ast.Node) bool {
+		e, ok := n.(ast.Expr)
+		if _, isParen := e.(*ast.ParenExpr); !ok || isParen {
+			return true
+		}
+		if _, isString := stringValue(e); isString {
+			exprs = append(exprs, e)
+			return false
+		}
+		return true
+	})
+	return exprs
+}
@@ -0,0 +1,94 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_expectationLiteral(t *testing.T) {
+	tests := []struct {
+		name   string
+		got    string
+		indent string
+		want   string
+	}{
+		{
+			name: "plain text",
+			got:  "foo",
+			want: "`foo`",
+		},
+		{
+			name: "backquotes",
+			got:  "a `b` c",
+			want: `"a ` + "`b`" + ` c"`,
+		},
+		{
+			name: "carriage return",
+			got:  "a\rb",
+			want: `"a\rb"`,
+		},
+		{
+			name: "NUL byte",
+			got:  "a\x00b",
+			want: `"a\x00b"`,
+		},
+		{
+			name: "invalid UTF-8",
+			got:  "a\xffb",
+			want: `"a\xffb"`,
+		},
+		{
+			name: "unicode",
+			got:  "héllo, 世界",
+			want: "`héllo, 世界`",
+		},
+		{
+			name:   "multiline",
+			got:    "foo\n  bar\n",
+			indent: "\t",
+			want:   "`\n\t\tfoo\n\t\t  bar\n\t\t`",
+		},
+		{
+			name: "multiline without indent",
+			got:  "foo\nbar",
+			want: "`\nfoo\nbar`",
+		},
+		{
+			name:   "multiline with backquotes",
+			got:    "a `b`\nc``",
+			indent: "\t",
+			want:   "`\n\t\ta ` + \"`\" + `b` + \"`\" + `\n\t\tc` + \"``\"",
+		},
+		{
+			name:   "multiline with carriage returns",
+			got:    "a\r\nb",
+			indent: "\t",
+			want:   `"a\r\nb"`,
+		},
+		{
+			name:   "leading newline with carriage return",
+			got:    "\na\r",
+			indent: "\t",
+			want:   `"\n\na\r"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expectationLiteral(tt.got, tt.indent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, got, tt.want)
+			if !literalRoundTrips(got, tt.got) {
+				t.Errorf("%s does not trim back to %q", got, tt.got)
+			}
+		})
+	}
+
+	t.Run("every line indented", func(t *testing.T) {
+		_, err := expectationLiteral("  a\n  b", "\t")
+		wantErr := `no Go string literal can hold "  a\n  b" as an expectation`
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+	})
+}
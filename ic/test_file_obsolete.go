@@ -0,0 +1,208 @@
+package ic
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/infra/cmd"
+)
+
+// RunTests runs the tests of a package like m.Run, then reports the stored
+// snapshots whose test no longer exists in the package, as happens when a test
+// is renamed or deleted. With IC_UPDATE=prune they are deleted instead. The
+// check is skipped when tests fail or only some of them ran. Golden files are
+// never checked, since they can't be told apart from the other files a test
+// reads from testdata. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(ic.RunTests(m))
+//	}
+func RunTests(m *testing.M) int {
+	code := m.Run()
+	d := NewTestFileUpdater()
+	if code != 0 || d.cmd.IsFiltered() {
+		return code
+	}
+	dir, err := os.Getwd()
+	if err == nil {
+		err = d.reportObsolete(os.Stdout, dir, d.cmd.UpdateMode() == cmd.UpdatePrune)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "IC: unable to check for obsolete snapshots: %s\n", err)
+		return 1
+	}
+	return code
+}
+
+// ObsoleteSnapshot is a stored snapshot whose test no longer exists
+type ObsoleteSnapshot struct {
+	// Path is the snapshot document holding the snapshot
+	Path string
+	// Key is the snapshot within the document at Path
+	Key string
+}
+
+func (o ObsoleteSnapshot) String() string {
+	return fmt.Sprintf("snapshot %q in %s", o.Key, o.Path)
+}
+
+// obsoleteSnapshots returns the snapshots stored for the package in dir whose
+// top-level test isn't declared in any of its test files. This doesn't depend
+// on which tests ran, so a test skipped for any reason keeps its snapshots.
+func (d TestFileUpdater) obsoleteSnapshots(dir string) ([]ObsoleteSnapshot, error) {
+	docDir := filepath.Join(dir, "testdata", "__snapshots__")
+	names, err := d.osFileManager.ReadDir(docDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	funcs, err := d.testFuncs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var obsolete []ObsoleteSnapshot
+	for _, name := range names {
+		if filepath.Ext(name) != ".snap" {
+			continue
+		}
+		docPath := filepath.Join(docDir, name)
+		doc, err := d.osFileManager.ReadFile(docPath)
+		if err != nil {
+			return nil, err
+		}
+		snapshots, err := parseSnapshots(doc)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", docPath, err)
+		}
+		for _, key := range sortedKeys(snapshots) {
+			if !funcs[topLevelTest(key)] {
+				obsolete = append(obsolete, ObsoleteSnapshot{Path: docPath, Key: key})
+			}
+		}
+	}
+	return obsolete, nil
+}
+
+// testFuncs returns the names of the functions declared in the test files in
+// dir. Files are read whatever their build constraints, so tests only built
+// with some tags keep their snapshots too.
+func (d TestFileUpdater) testFuncs(dir string) (map[string]bool, error) {
+	names, err := d.osFileManager.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	funcs := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if !strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		src, err := d.osFileManager.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcs[fn.Name.Name] = true
+			}
+		}
+	}
+	return funcs, nil
+}
+
+// topLevelTest returns the name of the top-level test that stored the
+// snapshot key, leaving out any subtests
+func topLevelTest(key string) string {
+	testName, _, _ := strings.Cut(key, " ")
+	testName, _, _ = strings.Cut(testName, "/")
+	return testName
+}
+
+// reportObsolete writes the snapshots of the package in dir that weren't read
+// to w, deleting them when prune is set
+func (d TestFileUpdater) reportObsolete(w io.Writer, dir string, prune bool) error {
+	obsolete, err := d.obsoleteSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	if !prune {
+		for _, o := range obsolete {
+			fmt.Fprintf(w, "IC: obsolete %s. Remove it with IC_UPDATE=prune\n", o)
+		}
+		return nil
+	}
+
+	keysByDoc := make(map[string][]string)
+	var docPaths []string
+	for _, o := range obsolete {
+		if keysByDoc[o.Path] == nil {
+			docPaths = append(docPaths, o.Path)
+		}
+		keysByDoc[o.Path] = append(keysByDoc[o.Path], o.Key)
+	}
+	for _, docPath := range docPaths {
+		if err = d.pruneSnapshots(docPath, keysByDoc[docPath]); err != nil {
+			return err
+		}
+		for _, key := range keysByDoc[docPath] {
+			fmt.Fprintf(w, "IC: Removed obsolete %s\n", ObsoleteSnapshot{Path: docPath, Key: key})
+		}
+	}
+	return nil
+}
+
+// pruneSnapshots removes keys from the snapshot document at docPath, and the
+// document itself once it holds no snapshots
+func (d TestFileUpdater) pruneSnapshots(docPath string, keys []string) error {
+	docFile, err := d.osFileManager.OpenRWLocked(docPath)
+	if err != nil {
+		return err
+	}
+	defer docFile.Close()
+
+	doc, err := docFile.ReadAll()
+	if err != nil {
+		return err
+	}
+	snapshots, err := parseSnapshots(doc)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", docPath, err)
+	}
+	for _, key := range keys {
+		delete(snapshots, key)
+	}
+	if len(snapshots) == 0 {
+		return d.osFileManager.Remove(docPath)
+	}
+	updated, err := formatSnapshots(snapshots)
+	if err != nil {
+		return err
+	}
+	return docFile.Rewrite(updated)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package ic
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_reportObsolete(t *testing.T) {
+	docPath := "/src/pkg/testdata/__snapshots__/foo_test.snap"
+	otherDocPath := "/src/pkg/testdata/__snapshots__/bar_test.snap"
+	newFiles := func() map[string]string {
+		return map[string]string{
+			"/src/pkg/foo_test.go": "package pkg\n\nfunc TestFoo(t *testing.T) {}\n",
+			// Tests built only with some tags count too
+			"/src/pkg/slow_test.go":           "//go:build slow\n\npackage pkg\n\nfunc TestSlow(t *testing.T) {}\n",
+			docPath:                           snapshotDocHeader + "-- TestFoo a --\na\n-- TestFoo/case_b b --\nb\n-- TestGone c --\nc\n-- TestSlow d --\nd\n",
+			otherDocPath:                      snapshotDocHeader + "-- TestBar a --\na\n",
+			"/src/pkg/testdata/unread.golden": "golden files are never checked\n",
+		}
+	}
+
+	t.Run("report", func(t *testing.T) {
+		files := newFiles()
+		d, _ := NewNullableTestFileUpdater(&files)
+
+		var out strings.Builder
+		if err := d.reportObsolete(&out, "/src/pkg", false); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, out.String(), `IC: obsolete snapshot "TestBar a" in /src/pkg/testdata/__snapshots__/bar_test.snap. Remove it with IC_UPDATE=prune
+IC: obsolete snapshot "TestGone c" in /src/pkg/testdata/__snapshots__/foo_test.snap. Remove it with IC_UPDATE=prune
+`)
+		if len(files) != len(newFiles()) {
+			t.Errorf("got %d files, want %d", len(files), len(newFiles()))
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		files := newFiles()
+		d, _ := NewNullableTestFileUpdater(&files)
+
+		var out strings.Builder
+		if err := d.reportObsolete(&out, "/src/pkg", true); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, out.String(), `IC: Removed obsolete snapshot "TestBar a" in /src/pkg/testdata/__snapshots__/bar_test.snap
+IC: Removed obsolete snapshot "TestGone c" in /src/pkg/testdata/__snapshots__/foo_test.snap
+`)
+		assertEqual(t, files[docPath], snapshotDocHeader+"-- TestFoo a --\na\n-- TestFoo/case_b b --\nb\n-- TestSlow d --\nd\n")
+		if _, found := files[otherDocPath]; found {
+			t.Errorf("%s was not removed", otherDocPath)
+		}
+		if _, found := files["/src/pkg/testdata/unread.golden"]; !found {
+			t.Error("the golden file was removed")
+		}
+	})
+
+	t.Run("no snapshots", func(t *testing.T) {
+		files := map[string]string{"/src/pkg/foo_test.go": "package pkg\n"}
+		d, _ := NewNullableTestFileUpdater(&files)
+
+		var out strings.Builder
+		if err := d.reportObsolete(&out, "/src/pkg", true); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, out.String(), "")
+	})
+
+	t.Run("unparsable test file", func(t *testing.T) {
+		files := newFiles()
+		files["/src/pkg/broken_test.go"] = "package pkg\n\nfunc {\n"
+		d, _ := NewNullableTestFileUpdater(&files)
+
+		var out strings.Builder
+		if err := d.reportObsolete(&out, "/src/pkg", true); err == nil {
+			t.Error("expected an error")
+		}
+		if len(files) != len(newFiles())+1 {
+			t.Errorf("got %d files, want %d", len(files), len(newFiles())+1)
+		}
+	})
+}
+
+func Test_topLevelTest(t *testing.T) {
+	assertEqual(t, topLevelTest("TestFoo a"), "TestFoo")
+	assertEqual(t, topLevelTest("TestFoo/case_a/nested name with spaces"), "TestFoo")
+}
@@ -0,0 +1,124 @@
+package ic
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/diff"
+)
+
+const patchHeader = "diff --git a/"
+
+// patchRunLine starts every patch, naming the run that wrote it. git apply
+// skips it like any other text before the first diff.
+const patchRunLine = "Updates recorded by github.com/BestFriendChris/go-ic in run %s. Apply them with \"git apply\".\n"
+
+// writePatch records the change from original to updated for fName in the
+// patch file instead of rewriting the file itself. Changes to other files,
+// including ones written by other test binaries, are kept, but a patch left
+// by an earlier run is replaced rather than added to.
+func (d TestFileUpdater) writePatch(fName string, original, updated []byte) (patchPath string, err error) {
+	root := d.repoRoot(fName)
+	patchPath = d.cmd.PatchPath()
+	if !filepath.IsAbs(patchPath) {
+		patchPath = filepath.Join(root, patchPath)
+	}
+	// git apply reads paths relative to the root, wherever the patch is
+	relPath, err := filepath.Rel(root, fName)
+	if err != nil {
+		return patchPath, err
+	}
+
+	// Test binaries for other packages may be writing the same patch
+	patchFile, err := d.osFileManager.OpenCreateLocked(patchPath)
+	if err != nil {
+		return patchPath, err
+	}
+	defer patchFile.Close()
+
+	existing, err := patchFile.ReadAll()
+	if err != nil {
+		return patchPath, err
+	}
+	runLine := fmt.Sprintf(patchRunLine, d.cmd.RunID())
+	if !strings.HasPrefix(string(existing), runLine) {
+		existing = nil
+	}
+	fileDiffs := splitPatch(string(existing))
+	fileDiffs[filepath.ToSlash(relPath)] = fileDiff(filepath.ToSlash(relPath), original, updated)
+	return patchPath, patchFile.Rewrite([]byte(runLine + joinPatch(fileDiffs)))
+}
+
+// repoRoot returns the closest directory above fName holding a .git
+// directory, or the directory of fName if there isn't one
+func (d TestFileUpdater) repoRoot(fName string) string {
+	start := filepath.Dir(fName)
+	for dir := start; ; dir = filepath.Dir(dir) {
+		if d.osFileManager.Exists(filepath.Join(dir, ".git")) {
+			return dir
+		}
+		if dir == filepath.Dir(dir) {
+			return start
+		}
+	}
+}
+
+// fileDiff returns a diff of a single file that "git apply" understands. A
+// nil original creates the file.
+func fileDiff(path string, original, updated []byte) string {
+	header := patchHeader + path + " b/" + path + "\n"
+	fromFile := "a/" + path
+	if original == nil {
+		header += "new file mode 100644\n"
+		fromFile = "/dev/null"
+	}
+	return header + diff.Unified{
+		A:        splitLines(string(original)),
+		B:        splitLines(string(updated)),
+		FromFile: fromFile,
+		ToFile:   "b/" + path,
+		Context:  3,
+	}.String()
+}
+
+// splitLines splits s after each newline. The last line has no newline if s
+// doesn't end with one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// splitPatch splits a patch written by writePatch into the diffs of each
+// file, leaving out the line naming the run
+func splitPatch(patch string) map[string]string {
+	fileDiffs := make(map[string]string)
+	var path string
+	for _, line := range splitLines(patch) {
+		if strings.HasPrefix(line, patchHeader) {
+			path = strings.TrimPrefix(line, patchHeader)
+			path = path[:strings.LastIndex(path, " b/")]
+		}
+		fileDiffs[path] += line
+	}
+	delete(fileDiffs, "")
+	return fileDiffs
+}
+
+func joinPatch(fileDiffs map[string]string) string {
+	paths := make([]string, 0, len(fileDiffs))
+	for path := range fileDiffs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		sb.WriteString(fileDiffs[path])
+	}
+	return sb.String()
+}
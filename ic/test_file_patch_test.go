@@ -0,0 +1,34 @@
+package ic
+
+import "testing"
+
+func Test_fileDiff(t *testing.T) {
+	original := "line 1\nline 2\nline 3\n"
+	updated := "line 1\nline two\nline 3\n"
+
+	got := fileDiff("pkg/foo_test.go", []byte(original), []byte(updated))
+	want := `diff --git a/pkg/foo_test.go b/pkg/foo_test.go
+--- a/pkg/foo_test.go
++++ b/pkg/foo_test.go
+@@ -1,3 +1,3 @@
+ line 1
+-line 2
++line two
+ line 3
+`
+	assertEqual(t, got, want)
+}
+
+func Test_splitPatch(t *testing.T) {
+	first := fileDiff("a_test.go", []byte("a\n"), []byte("A\n"))
+	second := fileDiff("b_test.go", []byte("b\n"), []byte("B\n"))
+	patch := joinPatch(map[string]string{"b_test.go": second, "a_test.go": first})
+	assertEqual(t, patch, first+second)
+
+	fileDiffs := splitPatch(patch)
+	if len(fileDiffs) != 2 {
+		t.Fatalf("got %d file diffs, want 2: %#v", len(fileDiffs), fileDiffs)
+	}
+	assertEqual(t, fileDiffs["a_test.go"], first)
+	assertEqual(t, fileDiffs["b_test.go"], second)
+}
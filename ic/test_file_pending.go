@@ -0,0 +1,292 @@
+package ic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/infra/os_file"
+)
+
+// PendingSnapshot is an expectation update recorded with IC_UPDATE=pending. It
+// stays pending, leaving the test file alone, until it is accepted or rejected.
+type PendingSnapshot struct {
+	// File is the test file holding the expectation
+	File string `json:"file"`
+	// Line and Column are the position of the expectation's string literal
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Old is the expectation in the test file and New is the output that
+	// should replace it
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+const pendingSuffix = ".ic.new"
+
+// PendingSnapshotPath returns the file holding the pending snapshots of testFile
+func PendingSnapshotPath(testFile string) string {
+	return filepath.Join(filepath.Dir(testFile), "testdata", ".ic-pending", filepath.Base(testFile)+pendingSuffix)
+}
+
+// PendingSnapshotTestFile returns the test file whose pending snapshots are
+// held in pendingPath. It is the reverse of PendingSnapshotPath.
+func PendingSnapshotTestFile(pendingPath string) string {
+	dir := filepath.Dir(filepath.Dir(filepath.Dir(pendingPath)))
+	return filepath.Join(dir, strings.TrimSuffix(filepath.Base(pendingPath), pendingSuffix))
+}
+
+// PendingSnapshots returns the pending snapshots of testFile
+func (d TestFileUpdater) PendingSnapshots(testFile string) ([]PendingSnapshot, error) {
+	path := PendingSnapshotPath(testFile)
+	if !d.osFileManager.Exists(path) {
+		return nil, nil
+	}
+	pendingFile, err := d.osFileManager.OpenRW(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pendingFile.Close()
+	return readPending(testFile, pendingFile)
+}
+
+// AcceptPending writes the new value of each snapshot into its test file and
+// removes it from the pending snapshots. Nothing is written for a test file
+// whose expectation no longer matches the old value of its snapshot.
+func (d TestFileUpdater) AcceptPending(snapshots ...PendingSnapshot) error {
+	for testFile, fileSnapshots := range groupByFile(snapshots) {
+		moved, err := d.acceptPendingFile(testFile, fileSnapshots)
+		if err != nil {
+			return err
+		}
+		err = d.updatePending(testFile, func(pending []PendingSnapshot) []PendingSnapshot {
+			remaining := withoutPending(pending, fileSnapshots)
+			// Accepted multiline expectations shift everything below them
+			for i := range remaining {
+				if pos, found := moved[[2]int{remaining[i].Line, remaining[i].Column}]; found {
+					remaining[i].Line, remaining[i].Column = pos.Line, pos.Column
+				}
+			}
+			return remaining
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RejectPending removes snapshots from the pending snapshots without
+// touching their test files
+func (d TestFileUpdater) RejectPending(snapshots ...PendingSnapshot) error {
+	for testFile, fileSnapshots := range groupByFile(snapshots) {
+		if err := d.removePending(testFile, fileSnapshots); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearPending removes the pending snapshot of the expectation that was just
+// checked, if there is one. It is called once the expectation matches again.
+func (d TestFileUpdater) ClearPending(ic *IC) {
+	ic.t.Helper()
+
+	loc, err := locateExpectation(testCallers(), ic.callerSkip, ic.t.Name(), d.original)
+	if err != nil {
+		// Expectations that can't be updated can't have pending snapshots either
+		return
+	}
+
+	stale := PendingSnapshot{File: loc.fName, Line: loc.line, Column: loc.column}
+	if err = d.removePending(loc.fName, []PendingSnapshot{stale}); err != nil {
+		ic.t.Logf("IC: error removing pending snapshot from %s: %s", PendingSnapshotPath(loc.fName), err)
+	}
+}
+
+// recordPending adds or replaces the pending snapshot for loc
+func (d TestFileUpdater) recordPending(loc expectationLocation, got string) error {
+	snapshot := PendingSnapshot{File: loc.fName, Line: loc.line, Column: loc.column, Old: loc.value, New: got}
+	return d.updatePending(loc.fName, func(snapshots []PendingSnapshot) []PendingSnapshot {
+		snapshots = append(withoutPending(snapshots, []PendingSnapshot{snapshot}), snapshot)
+		sort.Slice(snapshots, func(i, j int) bool {
+			if snapshots[i].Line != snapshots[j].Line {
+				return snapshots[i].Line < snapshots[j].Line
+			}
+			return snapshots[i].Column < snapshots[j].Column
+		})
+		return snapshots
+	})
+}
+
+// acceptPendingFile writes snapshots into testFile. It returns where each
+// string literal in the file moved to, keyed by its old line and column.
+func (d TestFileUpdater) acceptPendingFile(testFile string, snapshots []PendingSnapshot) (map[[2]int]token.Position, error) {
+	osFile, err := d.osFileManager.OpenRWLocked(testFile)
+	if err != nil {
+		return nil, err
+	}
+	defer osFile.Close()
+
+	src, err := osFile.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, testFile, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", testFile, err)
+	}
+
+	var edits []textEdit
+	for _, snapshot := range snapshots {
+		lit := findStringExpr(fset, f, snapshot.Line, snapshot.Column)
+		if lit == nil {
+			return nil, fmt.Errorf("no expectation found at %s:%d:%d", testFile, snapshot.Line, snapshot.Column)
+		}
+		loc, err := newExpectationLocation(testFile, fset, lit)
+		if err != nil {
+			return nil, err
+		}
+		if loc.value != snapshot.Old {
+			return nil, fmt.Errorf("expectation at %s:%d:%d has changed since the snapshot was recorded", testFile, snapshot.Line, snapshot.Column)
+		}
+		edits = append(edits, loc.edit(snapshot.New))
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+
+	updated, err := renderEdits(testFile, src, edits)
+	if err != nil {
+		return nil, err
+	}
+	updatedFset := token.NewFileSet()
+	updatedF, err := parser.ParseFile(updatedFset, testFile, updated, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", testFile, err)
+	}
+	// gofmt keeps the string literals in order, and each edit swaps one
+	// expectation for another, so the nth literal before is the nth after
+	before, after := stringExprPositions(fset, f), stringExprPositions(updatedFset, updatedF)
+	moved := make(map[[2]int]token.Position, len(before))
+	for i := range before {
+		moved[[2]int{before[i].Line, before[i].Column}] = after[i]
+	}
+	return moved, osFile.Rewrite(updated)
+}
+
+// stringExprPositions returns the position of every string literal in f, in order
+func stringExprPositions(fset *token.FileSet, f *ast.File) []token.Position {
+	var positions []token.Position
+	for _, e := range stringExprs(f) {
+		positions = append(positions, fset.Position(e.Pos()))
+	}
+	return positions
+}
+
+// findStringExpr returns the string literal starting at line and column
+func findStringExpr(fset *token.FileSet, f *ast.File, line, column int) ast.Expr {
+	for _, e := range stringExprs(f) {
+		pos := fset.Position(e.Pos())
+		if pos.Line == line && pos.Column == column {
+			return e
+		}
+	}
+	return nil
+}
+
+func (d TestFileUpdater) removePending(testFile string, remove []PendingSnapshot) error {
+	if !d.osFileManager.Exists(PendingSnapshotPath(testFile)) {
+		return nil
+	}
+	return d.updatePending(testFile, func(snapshots []PendingSnapshot) []PendingSnapshot {
+		return withoutPending(snapshots, remove)
+	})
+}
+
+// updatePending replaces the pending snapshots of testFile with the result of
+// update, holding a lock on them so parallel tests can't lose each other's
+// changes. The pending file is removed once there are no snapshots left.
+func (d TestFileUpdater) updatePending(testFile string, update func([]PendingSnapshot) []PendingSnapshot) error {
+	path := PendingSnapshotPath(testFile)
+	pendingFile, err := d.osFileManager.OpenCreateLocked(path)
+	if err != nil {
+		return err
+	}
+	defer pendingFile.Close()
+
+	snapshots, err := readPending(testFile, pendingFile)
+	if err != nil {
+		return err
+	}
+	snapshots = update(snapshots)
+	if len(snapshots) == 0 {
+		return d.osFileManager.Remove(path)
+	}
+
+	stored := make([]PendingSnapshot, len(snapshots))
+	for i, snapshot := range snapshots {
+		// Only the name is stored so the pending file can move with the test file
+		snapshot.File = filepath.Base(snapshot.File)
+		stored[i] = snapshot
+	}
+	var sb bytes.Buffer
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(stored); err != nil {
+		return err
+	}
+	return pendingFile.Rewrite(sb.Bytes())
+}
+
+func readPending(testFile string, pendingFile *os_file.OsFile) ([]PendingSnapshot, error) {
+	contents, err := pendingFile.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(contents)) == 0 {
+		// Just created by updatePending
+		return nil, nil
+	}
+	var snapshots []PendingSnapshot
+	if err = json.Unmarshal(contents, &snapshots); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", PendingSnapshotPath(testFile), err)
+	}
+	for i := range snapshots {
+		snapshots[i].File = testFile
+	}
+	return snapshots, nil
+}
+
+// withoutPending returns snapshots minus any at the same position as one in remove
+func withoutPending(snapshots, remove []PendingSnapshot) []PendingSnapshot {
+	var kept []PendingSnapshot
+	for _, snapshot := range snapshots {
+		isRemoved := false
+		for _, r := range remove {
+			if snapshot.Line == r.Line && snapshot.Column == r.Column {
+				isRemoved = true
+			}
+		}
+		if !isRemoved {
+			kept = append(kept, snapshot)
+		}
+	}
+	return kept
+}
+
+func groupByFile(snapshots []PendingSnapshot) map[string][]PendingSnapshot {
+	byFile := make(map[string][]PendingSnapshot)
+	for _, snapshot := range snapshots {
+		byFile[snapshot.File] = append(byFile[snapshot.File], snapshot)
+	}
+	return byFile
+}
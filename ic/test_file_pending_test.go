@@ -0,0 +1,99 @@
+package ic
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_PendingSnapshotPath(t *testing.T) {
+	path := PendingSnapshotPath("/src/pkg/foo_test.go")
+	assertEqual(t, path, "/src/pkg/testdata/.ic-pending/foo_test.go.ic.new")
+	assertEqual(t, PendingSnapshotTestFile(path), "/src/pkg/foo_test.go")
+}
+
+func Test_AcceptPending(t *testing.T) {
+	testFile := "/src/pkg/foo_test.go"
+	src := `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect("")
+	c.Expect("old")
+	c.Expect("other")
+}
+`
+	newFakeFs := func() map[string]string {
+		return map[string]string{
+			testFile: src,
+			PendingSnapshotPath(testFile): `[
+  {"file": "foo_test.go", "line": 4, "column": 11, "old": "", "new": "first"},
+  {"file": "foo_test.go", "line": 5, "column": 11, "old": "old", "new": "second\nline"},
+  {"file": "foo_test.go", "line": 6, "column": 11, "old": "other", "new": "third"}
+]`,
+		}
+	}
+
+	t.Run("accept", func(t *testing.T) {
+		fakeFs := newFakeFs()
+		tfu, _ := NewNullableTestFileUpdater(&fakeFs)
+		snapshots, err := tfu.PendingSnapshots(testFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 3 || snapshots[0].File != testFile {
+			t.Fatalf("got unexpected snapshots: %#v", snapshots)
+		}
+
+		if err = tfu.AcceptPending(snapshots[:2]...); err != nil {
+			t.Fatal(err)
+		}
+		want := `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(` + "`first`" + `)
+	c.Expect(` + "`" + `
+		second
+		line` + "`" + `)
+	c.Expect("other")
+}
+`
+		assertEqual(t, fakeFs[testFile], want)
+
+		remaining, err := tfu.PendingSnapshots(testFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(remaining) != 1 || remaining[0].New != "third" || remaining[0].Line != 8 {
+			t.Errorf("got unexpected remaining snapshots: %#v", remaining)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		fakeFs := newFakeFs()
+		tfu, _ := NewNullableTestFileUpdater(&fakeFs)
+		snapshots, _ := tfu.PendingSnapshots(testFile)
+
+		if err := tfu.RejectPending(snapshots...); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, fakeFs[testFile], src)
+		if _, found := fakeFs[PendingSnapshotPath(testFile)]; found {
+			t.Error("expected the pending snapshots to be removed")
+		}
+	})
+
+	t.Run("test file changed since recording", func(t *testing.T) {
+		fakeFs := newFakeFs()
+		fakeFs[testFile] = strings.Replace(src, `"old"`, `"edited"`, 1)
+		tfu, _ := NewNullableTestFileUpdater(&fakeFs)
+		snapshots, _ := tfu.PendingSnapshots(testFile)
+
+		err := tfu.AcceptPending(snapshots...)
+		wantErr := "expectation at /src/pkg/foo_test.go:5:11 has changed since the snapshot was recorded"
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+		if !strings.Contains(fakeFs[testFile], `"edited"`) {
+			t.Error("expected the test file to be left alone")
+		}
+	})
+}
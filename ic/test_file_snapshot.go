@@ -0,0 +1,212 @@
+package ic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/BestFriendChris/go-ic/ic/internal/infra/cmd"
+)
+
+// snapshotDocHeader starts every snapshot document, ahead of the snapshots
+const snapshotDocHeader = "Snapshots recorded by github.com/BestFriendChris/go-ic. Update them with IC_UPDATE.\n"
+
+// snapshotMarker starts each snapshot in a snapshot document. The format is
+// that of txtar, with a snapshot per file.
+var snapshotMarker = regexp.MustCompile(`^-- (.+) --$`)
+
+// snapshotDocPath returns the snapshot document of the running test's file
+func snapshotDocPath() (string, error) {
+	callers := testCallers()
+	if len(callers) == 0 {
+		return "", errors.New("unable to find the test file holding the running test")
+	}
+	testFile := callers[len(callers)-1].file
+	return SnapshotDocPath(testFile), nil
+}
+
+// SnapshotDocPath returns the document holding the snapshots of testFile
+func SnapshotDocPath(testFile string) string {
+	name := strings.TrimSuffix(filepath.Base(testFile), ".go") + ".snap"
+	return filepath.Join(filepath.Dir(testFile), "testdata", "__snapshots__", name)
+}
+
+// snapshotKey returns the key of the snapshot name taken by the test testName.
+// Test names never contain spaces, so the key can be split up again.
+func snapshotKey(testName, name string) (string, error) {
+	if name == "" || strings.Contains(name, "\n") {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return testName + " " + name, nil
+}
+
+// snapshotUpdates remembers every snapshot updated during a test run, so that
+// a patch can hold all of them
+type snapshotUpdates struct {
+	mu   sync.Mutex
+	docs map[string]map[string]string
+}
+
+var globalSnapshotUpdates = newSnapshotUpdates()
+
+func newSnapshotUpdates() *snapshotUpdates {
+	return &snapshotUpdates{docs: make(map[string]map[string]string)}
+}
+
+// add records the update of key in docPath and applies every update made to
+// docPath so far to snapshots
+func (su *snapshotUpdates) add(docPath, key, got string, snapshots map[string]string) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+
+	if su.docs[docPath] == nil {
+		su.docs[docPath] = make(map[string]string)
+	}
+	su.docs[docPath][key] = got
+	for k, v := range su.docs[docPath] {
+		snapshots[k] = v
+	}
+}
+
+// readSnapshot returns the snapshot key from the document at docPath
+func (d TestFileUpdater) readSnapshot(docPath, key string) (snapshot string, exists bool, err error) {
+	doc, err := d.osFileManager.ReadFile(docPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	snapshots, err := parseSnapshots(doc)
+	if err != nil {
+		return "", false, err
+	}
+	snapshot, exists = snapshots[key]
+	return snapshot, exists, nil
+}
+
+// UpdateSnapshot replaces the snapshot key in the document at docPath with got
+func (d TestFileUpdater) UpdateSnapshot(ic *IC, docPath, key, got string) {
+	ic.t.Helper()
+
+	switch d.cmd.UpdateMode() {
+	case cmd.UpdatePending:
+		ic.t.Logf("IC: pending snapshots are not supported for named snapshots. Use IC_UPDATE=all or IC_UPDATE=patch:<file> to update %q", key)
+		return
+	case cmd.UpdatePatch:
+		original, err := d.osFileManager.ReadFile(docPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			ic.t.Logf("IC: error reading snapshots from %s: %s", docPath, err)
+			ic.t.FailNow()
+			return
+		}
+		updated, err := d.updatedSnapshots(original, docPath, key, got)
+		if err != nil {
+			ic.t.Logf("IC: unable to update snapshot: %s", err)
+			ic.t.FailNow()
+			return
+		}
+		absPath, err := filepath.Abs(docPath)
+		if err != nil {
+			ic.t.Logf("IC: error finding snapshots %s: %s", docPath, err)
+			ic.t.FailNow()
+			return
+		}
+		patchPath, err := d.writePatch(absPath, original, updated)
+		if err != nil {
+			ic.t.Logf("IC: error writing patch %s: %s", patchPath, err)
+			ic.t.FailNow()
+			return
+		}
+		ic.t.Logf("IC: Recorded update in patch %s", patchPath)
+		return
+	}
+
+	docFile, err := d.osFileManager.OpenCreateLocked(docPath)
+	if err != nil {
+		ic.t.Logf("IC: error opening snapshots %s: %s", docPath, err)
+		ic.t.FailNow()
+		return
+	}
+	defer docFile.Close()
+
+	current, err := docFile.ReadAll()
+	if err != nil {
+		ic.t.Logf("IC: error reading snapshots from %s: %s", docPath, err)
+		ic.t.FailNow()
+		return
+	}
+	updated, err := d.updatedSnapshots(current, docPath, key, got)
+	if err != nil {
+		ic.t.Logf("IC: unable to update snapshot: %s", err)
+		ic.t.FailNow()
+		return
+	}
+
+	ic.t.Logf("IC: Updating snapshot %q in %s. Rerun tests to verify", key, docPath)
+	if err = docFile.Rewrite(updated); err != nil {
+		ic.t.Logf("IC: error writing snapshots %s: %s", docPath, err)
+		ic.t.FailNow()
+	}
+}
+
+// updatedSnapshots returns doc with the snapshot key set to got, along with
+// every other update made to it during this run
+func (d TestFileUpdater) updatedSnapshots(doc []byte, docPath, key, got string) ([]byte, error) {
+	snapshots, err := parseSnapshots(doc)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", docPath, err)
+	}
+	d.snapshots.add(docPath, key, got, snapshots)
+	return formatSnapshots(snapshots)
+}
+
+// parseSnapshots reads a snapshot document, returning the snapshots by key
+func parseSnapshots(doc []byte) (map[string]string, error) {
+	snapshots := make(map[string]string)
+	var key string
+	var content strings.Builder
+	isInSnapshot := false
+	finish := func() {
+		if isInSnapshot {
+			// formatSnapshots ends every snapshot with a newline of its own
+			snapshots[key] = strings.TrimSuffix(content.String(), "\n")
+		}
+	}
+	for _, line := range splitLines(string(doc)) {
+		if m := snapshotMarker.FindStringSubmatch(strings.TrimSuffix(line, "\n")); m != nil {
+			finish()
+			key = m[1]
+			if _, found := snapshots[key]; found {
+				return nil, fmt.Errorf("snapshot %q is recorded twice", key)
+			}
+			content.Reset()
+			isInSnapshot = true
+			continue
+		}
+		content.WriteString(line)
+	}
+	finish()
+	return snapshots, nil
+}
+
+// formatSnapshots writes a snapshot document holding snapshots, in order of
+// their keys so that documents change as little as possible
+func formatSnapshots(snapshots map[string]string) ([]byte, error) {
+	var doc bytes.Buffer
+	doc.WriteString(snapshotDocHeader)
+	for _, key := range sortedKeys(snapshots) {
+		snapshot := snapshots[key]
+		for _, line := range strings.Split(snapshot, "\n") {
+			if snapshotMarker.MatchString(line) {
+				return nil, fmt.Errorf("snapshot %q has a line that looks like the start of a snapshot: %q", key, line)
+			}
+		}
+		fmt.Fprintf(&doc, "-- %s --\n%s\n", key, snapshot)
+	}
+	return doc.Bytes(), nil
+}
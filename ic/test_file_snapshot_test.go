@@ -0,0 +1,58 @@
+package ic
+
+import (
+	"testing"
+)
+
+func Test_formatSnapshots(t *testing.T) {
+	snapshots := map[string]string{
+		"TestFoo/case_b report": "line 1\nline 2\n",
+		"TestFoo/case_a report": "no trailing newline",
+		"TestBar empty":         "",
+	}
+	doc, err := formatSnapshots(snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := snapshotDocHeader + `-- TestBar empty --
+
+-- TestFoo/case_a report --
+no trailing newline
+-- TestFoo/case_b report --
+line 1
+line 2
+
+`
+	assertEqual(t, string(doc), want)
+
+	parsed, err := parseSnapshots(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(snapshots) {
+		t.Fatalf("got %d snapshots, want %d", len(parsed), len(snapshots))
+	}
+	for key, snapshot := range snapshots {
+		assertEqual(t, parsed[key], snapshot)
+	}
+
+	t.Run("content that looks like a marker", func(t *testing.T) {
+		_, err := formatSnapshots(map[string]string{"TestFoo x": "a\n-- b --\n"})
+		wantErr := `snapshot "TestFoo x" has a line that looks like the start of a snapshot: "-- b --"`
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+	})
+
+	t.Run("repeated key", func(t *testing.T) {
+		_, err := parseSnapshots([]byte("-- TestFoo x --\na\n-- TestFoo x --\nb\n"))
+		wantErr := `snapshot "TestFoo x" is recorded twice`
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+	})
+}
+
+func Test_SnapshotDocPath(t *testing.T) {
+	assertEqual(t, SnapshotDocPath("/src/pkg/foo_test.go"), "/src/pkg/testdata/__snapshots__/foo_test.snap")
+}
@@ -1,37 +1,41 @@
 package ic
 
 import (
-	"bytes"
-	"runtime"
-	"strings"
-	"sync/atomic"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 
-	"github.com/BestFriendChris/go-ic/ic/internal/infra/atomic_bool"
 	"github.com/BestFriendChris/go-ic/ic/internal/infra/cmd"
 	"github.com/BestFriendChris/go-ic/ic/internal/infra/os_file"
 )
 
 func NewTestFileUpdater() TestFileUpdater {
 	return TestFileUpdater{
-		alreadySeen:   atomic_bool.NewGlobal(),
+		edits:         globalTestFileEdits,
+		snapshots:     globalSnapshotUpdates,
 		osFileManager: os_file.New(),
 		cmd:           cmd.New(),
 	}
 }
 
-func NewNullableTestFileUpdater(testFiles *map[string]string) (TestFileUpdater, *atomic.Bool, *cmd.OverridableFlagChecker) {
-	alreadySeen, underlyingBool := atomic_bool.NewNullable()
+func NewNullableTestFileUpdater(testFiles *map[string]string) (TestFileUpdater, *cmd.OverridableFlagChecker) {
 	osFileManager := os_file.NewNullable(testFiles)
 	c, ofc := cmd.NewNullable()
 	return TestFileUpdater{
-		alreadySeen:   alreadySeen,
+		edits:         newTestFileEdits(),
+		snapshots:     newSnapshotUpdates(),
 		osFileManager: osFileManager,
 		cmd:           c,
-	}, underlyingBool, ofc
+	}, ofc
 }
 
+// TestFileUpdater rewrites expectations in test files. Every update made
+// during a test run is kept, so a single run records all of them.
 type TestFileUpdater struct {
-	alreadySeen   *atomic_bool.AtomicBool
+	edits         *testFileEdits
+	snapshots     *snapshotUpdates
 	osFileManager *os_file.OsFileManager
 	cmd           *cmd.Cmd
 }
@@ -40,99 +44,530 @@ func (d TestFileUpdater) UpdateEnabled() bool {
 	return d.cmd.IsUpdateEnabled()
 }
 
-func (d TestFileUpdater) Update(ic *IC, got string) {
+func (d TestFileUpdater) UpdateMode() cmd.UpdateMode {
+	return d.cmd.UpdateMode()
+}
+
+func (d TestFileUpdater) UseColor() bool {
+	return d.cmd.UseColor()
+}
+
+func (d TestFileUpdater) DiffStyle() string {
+	return d.cmd.DiffStyle()
+}
+
+var errAlreadyUpdated = errors.New("expectation already updated")
+
+// Update replaces the expectation want of the Expect call that is running
+// with got. It refuses to touch the test file when the expectation found in
+// the source isn't want, since the source has then changed since the test was
+// built and the update could land in the wrong place.
+func (d TestFileUpdater) Update(ic *IC, want, got string) {
 	ic.t.Helper()
 
-	_, fName, lineNo, ok := runtime.Caller(3)
-	if !ok {
+	callers := testCallers()
+	if len(callers) == 0 {
 		panic("update was called incorrectly")
 	}
 
-	if d.alreadySeen.Set() {
-		ic.t.Log(`IC: already updated a test file. Skipping update. Rerun tests to try again`)
+	loc, err := locateExpectation(callers, ic.callerSkip, ic.t.Name(), d.original)
+	if err == nil {
+		err = loc.verify(want)
+	}
+	if err != nil {
+		ic.t.Logf("IC: unable to update test file: %s", err)
+		ic.t.FailNow()
+		return
+	}
+
+	if d.cmd.UpdateMode() == cmd.UpdatePending {
+		if err = d.recordPending(loc, got); err != nil {
+			ic.t.Logf("IC: error recording pending snapshot in %s: %s", PendingSnapshotPath(loc.fName), err)
+			ic.t.FailNow()
+			return
+		}
+		ic.t.Logf("IC: Recorded pending snapshot in %s", PendingSnapshotPath(loc.fName))
 		return
 	}
 
-	osFile, err := d.osFileManager.OpenRW(fName)
+	updated, err := d.edits.add(loc.fName, loc.edit(got))
+	if errors.Is(err, errAlreadyUpdated) {
+		ic.t.Log(`IC: expectation already updated during this run. Skipping update. Rerun tests to try again`)
+		return
+	} else if err != nil {
+		ic.t.Logf("IC: unable to update test file: %s", err)
+		ic.t.FailNow()
+		return
+	}
+
+	if d.cmd.UpdateMode() == cmd.UpdatePatch {
+		original, _ := d.original(loc.fName)
+		patchPath, err := d.writePatch(loc.fName, original, updated)
+		if err != nil {
+			ic.t.Logf("IC: error writing patch %s: %s", patchPath, err)
+			ic.t.FailNow()
+			return
+		}
+		ic.t.Logf("IC: Recorded update in patch %s", patchPath)
+		return
+	}
+
+	osFile, err := d.osFileManager.OpenRWLocked(loc.fName)
 	if err != nil {
 		ic.t.Log("error opening test file for update")
 		ic.t.FailNow()
+		return
 	}
 	defer osFile.Close()
 
-	scanner := osFile.Scanner()
+	// Other tests may have updated the file since it was read, so the edit is
+	// applied to what is there now
+	updated, err = d.rebase(loc, got, osFile)
+	if err != nil {
+		ic.t.Logf("IC: unable to update test file: %s", err)
+		ic.t.FailNow()
+		return
+	}
+
+	ic.t.Log(`IC: Updating test file. Rerun tests to verify`)
+
+	// rewrite the test file!
+	err = osFile.Rewrite(updated)
+	if err != nil {
+		ic.t.Log("error writing test file on update")
+		ic.t.FailNow()
+	}
+}
 
-	var sb bytes.Buffer
-	// Skip previous lines
-	for i := 0; i < lineNo-1; i++ {
-		scanner.Scan()
-		sb.WriteString(scanner.Text() + "\n")
+// rebase applies the edit for loc to the current contents of osFile, which
+// must be locked
+func (d TestFileUpdater) rebase(loc expectationLocation, got string, osFile *os_file.OsFile) ([]byte, error) {
+	current, err := osFile.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	original, err := d.original(loc.fName)
+	if err != nil {
+		return nil, err
 	}
+	e, err := rebaseEdit(loc.fName, original, current, loc.edit(got))
+	if err != nil {
+		return nil, err
+	}
+	return renderEdits(loc.fName, current, []textEdit{e})
+}
 
-	var line string
-	for scanner.Scan() {
-		line = scanner.Text()
-		if strings.IndexAny(line, "`\"") >= 0 {
-			// This is the line with the `` or ""
-			break
+// original returns the contents of fName from before any updates in this run
+func (d TestFileUpdater) original(fName string) ([]byte, error) {
+	return d.edits.original(fName, func() ([]byte, error) {
+		osFile, err := d.osFileManager.OpenRW(fName)
+		if err != nil {
+			return nil, err
 		}
-		sb.WriteString(line + "\n")
+		defer osFile.Close()
+		return osFile.ReadAll()
+	})
+}
+
+// expectMethods are the IC methods that take an expectation, along with the
+// index of the expectation in their arguments
+var expectMethods = map[string]int{
+	"Expect":            0,
+	"ExpectAndContinue": 0,
+	"ExpectBytes":       1,
+	"ExpectUnordered":   0,
+	"ExpectJSON":        0,
+}
+
+// callTarget describes the call to look for in a caller's source. An empty
+// set of names matches any call, and an argIndex of -1 means the argument is
+// whichever one is a string literal.
+type callTarget struct {
+	names    map[string]int
+	argIndex int
+}
+
+// expectationLocation is the string literal, or concatenation of string
+// literals, that holds an expectation
+type expectationLocation struct {
+	fName        string
+	start, end   int
+	line, column int
+	// value is what the literal evaluates to
+	value string
+	// isDirect is set when the literal is passed to Expect unchanged, rather
+	// than through a helper that could transform it
+	isDirect bool
+}
+
+func newExpectationLocation(fName string, fset *token.FileSet, lit ast.Expr) (expectationLocation, error) {
+	value, ok := stringValue(lit)
+	if !ok {
+		return expectationLocation{}, fmt.Errorf("expectation at %s is not a string literal", fset.Position(lit.Pos()))
+	}
+	pos := fset.Position(lit.Pos())
+	return expectationLocation{
+		fName:  fName,
+		start:  pos.Offset,
+		end:    fset.Position(lit.End()).Offset,
+		line:   pos.Line,
+		column: pos.Column,
+		value:  value,
+	}, nil
+}
+
+// verify checks that the literal is the expectation want that Expect was
+// given. Line numbers come from the test binary, so the literal only matches
+// if the source is still what the binary was built from.
+func (l expectationLocation) verify(want string) error {
+	if l.isDirect && l.value != want {
+		return fmt.Errorf("the expectation at %s:%d is %q, but the running test expected %q. "+
+			"The file has changed since the test was built. Rerun the tests to update it",
+			l.fName, l.line, l.value, want)
 	}
+	return nil
+}
 
-	var numTabs int
-	idx := strings.Index(line, "Expect(")
-	// This is the line with Expect on it
-	if idx > -1 {
-		numTabs = strings.Count(line[:idx], "\t")
-		// We need to write everything up to the '('
-		sb.WriteString(line[:idx])
-		line = line[idx:]
+func (l expectationLocation) edit(got string) textEdit {
+	return textEdit{start: l.start, end: l.end, got: got}
+}
 
-		idx = strings.Index(line, "(") + 1
-		sb.WriteString(line[:idx])
-		line = line[idx:]
+// locateExpectation walks the callers of Expect until it finds the string
+// literal that was passed in as the expectation. The first skip callers are
+// ignored, as are callers in functions marked with t.Helper() that don't
+// contain the literal themselves. String parameters of helper functions are
+// followed back to the call site that provided them.
+func locateExpectation(callers []callerFrame, skip int, testName string, readFile func(string) ([]byte, error)) (expectationLocation, error) {
+	if skip >= len(callers) {
+		return expectationLocation{}, fmt.Errorf("caller skip of %d is past the top of the test", skip)
 	}
 
-	idx = strings.IndexAny(line, "`\"")
-	if idx == -1 || line[idx] != line[idx+1] {
-		panic("should not be possible to not find either `` or \"\"")
+	target := callTarget{names: expectMethods}
+	isDirect := true
+	if skip > 0 {
+		target = callTarget{argIndex: -1}
+		isDirect = false
 	}
-	if idx > 0 {
-		// There is (most likely) whitespace before the empty quotes
-		sb.WriteString(line[:idx])
-		line = line[idx:]
+	for i, caller := range callers[skip:] {
+		src, err := readFile(caller.file)
+		if err != nil {
+			return expectationLocation{}, err
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, caller.file, src, parser.ParseComments)
+		if err != nil {
+			return expectationLocation{}, fmt.Errorf("parsing %s: %w", caller.file, err)
+		}
+
+		call := findCall(fset, f, caller.line, target)
+		var fn enclosingFunc
+		if call != nil {
+			fn = findEnclosingFunc(f, call.Pos())
+		} else {
+			fn = findEnclosingFunc(f, fset.File(f.Pos()).LineStart(caller.line))
+		}
+		isLast := skip+i == len(callers)-1
+
+		if call == nil {
+			if fn.isHelper && fn.name != "" && !isLast {
+				target = callTarget{names: map[string]int{fn.name: -1}, argIndex: -1}
+				isDirect = false
+				continue
+			}
+			return expectationLocation{}, fmt.Errorf("no %s call found at %s:%d. Has the file changed since the test was built?", target.describe(), caller.file, caller.line)
+		}
+
+		arg := targetArg(call, target)
+		switch a := arg.(type) {
+		case *ast.Ident:
+			if fn.paramIndex(a) < 0 {
+				arg, err = resolveString(f, a)
+			}
+		case *ast.SelectorExpr:
+			arg, err = resolveCaseField(f, a, testName)
+		}
+		if err != nil {
+			return expectationLocation{}, fmt.Errorf("argument to %s at %s:%d: %w", target.describe(), caller.file, caller.line, err)
+		}
+		if _, isString := stringValue(arg); isString {
+			loc, err := newExpectationLocation(caller.file, fset, arg)
+			loc.isDirect = isDirect
+			return loc, err
+		}
+		if !isLast && fn.name != "" {
+			if ident, ok := arg.(*ast.Ident); ok {
+				if idx := fn.paramIndex(ident); idx >= 0 {
+					target = callTarget{names: map[string]int{fn.name: idx}}
+					continue
+				}
+			}
+			if fn.isHelper {
+				target = callTarget{names: map[string]int{fn.name: -1}, argIndex: -1}
+				isDirect = false
+				continue
+			}
+		}
+		return expectationLocation{}, fmt.Errorf("argument to %s at %s:%d is not a string literal", target.describe(), caller.file, caller.line)
 	}
+	return expectationLocation{}, errors.New("unable to find the expectation in the callers of Expect")
+}
 
-	sb.WriteString("`")
-	isMultiline := strings.Index(got, "\n") >= 0
-	if isMultiline {
-		// update as multiline
-		sb.WriteString("\n")
+// resolveString returns the string literal that the variable or constant
+// ident was declared with
+func resolveString(f *ast.File, ident *ast.Ident) (ast.Expr, error) {
+	value, err := resolveDecl(f, ident)
+	if err != nil {
+		return nil, err
 	}
-	got = strings.ReplaceAll(got, "`", "` + \"`\" + `")
-	if isMultiline && numTabs > 0 {
-		prefixTabs := strings.Repeat("\t", numTabs+1)
-		sb.WriteString(prefixTabs)
-		sb.WriteString(strings.ReplaceAll(got, "\n", "\n"+prefixTabs))
-	} else {
-		sb.WriteString(got)
+	if _, isString := stringValue(value); !isString {
+		return nil, fmt.Errorf("%s is not set to a string literal", ident.Name)
 	}
-	sb.WriteString("`")
+	return value, nil
+}
 
-	// write out the rest of the line skipping the empty quotes
-	sb.WriteString(line[2:] + "\n")
+// resolveDecl returns the value that the variable or constant ident was
+// declared with, following other identifiers it is set to
+func resolveDecl(f *ast.File, ident *ast.Ident) (ast.Expr, error) {
+	for {
+		if ident.Obj == nil {
+			return nil, fmt.Errorf("%s is not declared in this file", ident.Name)
+		}
 
-	// write out the rest of the lines
-	for scanner.Scan() {
-		sb.WriteString(scanner.Text() + "\n")
+		var value ast.Expr
+		switch decl := ident.Obj.Decl.(type) {
+		case *ast.AssignStmt:
+			if decl.Tok == token.DEFINE && len(decl.Lhs) == len(decl.Rhs) {
+				for i, lhs := range decl.Lhs {
+					if lhsIdent, ok := lhs.(*ast.Ident); ok && lhsIdent.Obj == ident.Obj {
+						value = decl.Rhs[i]
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if len(decl.Names) == len(decl.Values) {
+				for i, name := range decl.Names {
+					if name.Obj == ident.Obj {
+						value = decl.Values[i]
+					}
+				}
+			}
+		case *ast.Field:
+			return nil, fmt.Errorf("%s is a parameter of an enclosing function", ident.Name)
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%s is not declared with a value of its own", ident.Name)
+		}
+		if isReassigned(f, ident.Obj) {
+			return nil, fmt.Errorf("%s is assigned more than once, so its value at the call can't be known", ident.Name)
+		}
+
+		value = unparen(value)
+		next, ok := value.(*ast.Ident)
+		if !ok {
+			return value, nil
+		}
+		ident = next
 	}
+}
 
-	ic.t.Log(`IC: Updating test file. Rerun tests to verify`)
+// isReassigned reports whether obj is assigned anywhere other than where it
+// is declared
+func isReassigned(f *ast.File, obj *ast.Object) bool {
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign == obj.Decl {
+			return !found
+		}
+		for _, lhs := range assign.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Obj == obj {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
 
-	// rewrite the test file!
-	err = osFile.Rewrite(sb.Bytes())
-	if err != nil {
-		ic.t.Log("error writing test file on update")
-		ic.t.FailNow()
+func (ct callTarget) describe() string {
+	if len(ct.names) == 0 {
+		return "function"
+	}
+	if _, isExpect := ct.names["Expect"]; isExpect {
+		return "Expect"
+	}
+	for name := range ct.names {
+		return name
+	}
+	panic("unreachable")
+}
+
+// findCall returns the call matching target that runtime.Caller would report
+// at lineNo. The compiler reports the line of the function name, but any line
+// spanned by the call is accepted so long as nothing better matches.
+func findCall(fset *token.FileSet, f *ast.File, lineNo int, target callTarget) *ast.CallExpr {
+	var best *ast.CallExpr
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		name := calleeName(call)
+		if name == nil {
+			return true
+		}
+		if len(target.names) > 0 {
+			if _, found := target.names[name.Name]; !found {
+				return true
+			}
+		}
+		if targetArg(call, target) == nil {
+			return true
+		}
+		first := fset.Position(name.Pos()).Line
+		last := fset.Position(call.Rparen).Line
+		if lineNo < first || lineNo > last {
+			return true
+		}
+		if best == nil || (first == lineNo && fset.Position(calleeName(best).Pos()).Line != lineNo) {
+			best = call
+		}
+		return true
+	})
+	return best
+}
+
+func calleeName(call *ast.CallExpr) *ast.Ident {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	}
+	return nil
+}
+
+// targetArg returns the argument of call that target refers to, if any
+func targetArg(call *ast.CallExpr, target callTarget) ast.Expr {
+	argIndex := target.argIndex
+	if len(target.names) > 0 {
+		argIndex = target.names[calleeName(call).Name]
+	}
+	if argIndex >= 0 {
+		if argIndex >= len(call.Args) {
+			return nil
+		}
+		return unparen(call.Args[argIndex])
+	}
+
+	// Use the only string literal argument
+	var found ast.Expr
+	for _, arg := range call.Args {
+		if _, isString := stringValue(unparen(arg)); isString {
+			if found != nil {
+				return nil
+			}
+			found = unparen(arg)
+		}
+	}
+	return found
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// enclosingFunc is the innermost function declaration or literal around a
+// position in the source
+type enclosingFunc struct {
+	// name is how callers refer to the function. It is empty for function
+	// literals that aren't assigned to a variable.
+	name     string
+	typ      *ast.FuncType
+	isHelper bool
+}
+
+func findEnclosingFunc(f *ast.File, pos token.Pos) enclosingFunc {
+	var fn enclosingFunc
+	assignedNames := make(map[*ast.FuncLit]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			fn = enclosingFunc{name: n.Name.Name, typ: n.Type, isHelper: callsHelper(n.Body)}
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, rhs := range n.Rhs {
+					lit, isLit := rhs.(*ast.FuncLit)
+					ident, isIdent := n.Lhs[i].(*ast.Ident)
+					if isLit && isIdent {
+						assignedNames[lit] = ident.Name
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == len(n.Values) {
+				for i, value := range n.Values {
+					if lit, isLit := value.(*ast.FuncLit); isLit {
+						assignedNames[lit] = n.Names[i].Name
+					}
+				}
+			}
+		case *ast.FuncLit:
+			fn = enclosingFunc{name: assignedNames[n], typ: n.Type, isHelper: callsHelper(n.Body)}
+		}
+		return true
+	})
+	return fn
+}
+
+// callsHelper reports whether body calls t.Helper() directly
+func callsHelper(body *ast.BlockStmt) bool {
+	if body == nil {
+		return false
+	}
+	for _, stmt := range body.List {
+		expr, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		call, ok := expr.X.(*ast.CallExpr)
+		if !ok || len(call.Args) != 0 {
+			continue
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Helper" {
+			return true
+		}
+	}
+	return false
+}
+
+// paramIndex returns the position of ident in the function's parameters, or
+// -1 if it isn't one of them
+func (fn enclosingFunc) paramIndex(ident *ast.Ident) int {
+	if fn.typ == nil || ident.Obj == nil {
+		return -1
+	}
+	i := 0
+	for _, field := range fn.typ.Params.List {
+		if len(field.Names) == 0 {
+			i++
+			continue
+		}
+		for _, name := range field.Names {
+			if name.Obj == ident.Obj {
+				return i
+			}
+			i++
+		}
 	}
+	return -1
 }
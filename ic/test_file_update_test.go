@@ -0,0 +1,681 @@
+package ic
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_locateExpectation(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		lineNo   int
+		testName string
+		got      string
+		want     string
+	}{
+		{
+			name: "single line",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(` + "``" + `)
+}
+`,
+			lineNo: 4,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "multiline output is indented",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.ExpectAndContinue("")
+}
+`,
+			lineNo: 4,
+			got:    "foo\nbar",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.ExpectAndContinue(` + "`" + `
+		foo
+		bar` + "`" + `)
+}
+`,
+		},
+		{
+			name: "comment between call and argument",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect( /* "not this" */
+		// or ` + "`this`" + `
+		"")
+}
+`,
+			lineNo: 4,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect( /* "not this" */
+		// or ` + "`this`" + `
+		` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "other string literals on the same line",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Print("first"); c.Expect(""); c.Print("last")
+}
+`,
+			lineNo: 4,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.Print("first")
+	c.Expect(` + "`foo`" + `)
+	c.Print("last")
+}
+`,
+		},
+		{
+			name: "call split across lines",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.
+		Expect(
+			"",
+		)
+}
+`,
+			lineNo: 5,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.
+		Expect(
+			` + "`foo`" + `,
+		)
+}
+`,
+		},
+		{
+			name: "concatenated string literals",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect("a " + "` + "`b`" + `")
+}
+`,
+			lineNo: 4,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "local variable",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	want := ""
+	c.Expect(want)
+}
+`,
+			lineNo: 5,
+			got:    "foo\nbar",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	want := ` + "`" + `
+		foo
+		bar` + "`" + `
+	c.Expect(want)
+}
+`,
+		},
+		{
+			name: "package level constant",
+			src: `package p
+
+const (
+	other      = "other"
+	wantReport = ""
+)
+
+func TestFoo(t *testing.T) {
+	c.Expect(wantReport)
+}
+`,
+			lineNo: 9,
+			got:    "foo",
+			want: `package p
+
+const (
+	other      = "other"
+	wantReport = ` + "`foo`" + `
+)
+
+func TestFoo(t *testing.T) {
+	c.Expect(wantReport)
+}
+`,
+		},
+		{
+			name: "variable set to a constant",
+			src: `package p
+
+const wantReport = ""
+
+func TestFoo(t *testing.T) {
+	var want = wantReport
+	c.Expect(want)
+}
+`,
+			lineNo: 7,
+			got:    "foo",
+			want: `package p
+
+const wantReport = ` + "`foo`" + `
+
+func TestFoo(t *testing.T) {
+	var want = wantReport
+	c.Expect(want)
+}
+`,
+		},
+		{
+			name: "table case matched by subtest name",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{name: "case a", want: ""},
+		{name: "case b", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   10,
+			testName: "TestFoo/case_b",
+			got:      "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{name: "case a", want: ""},
+		{name: "case b", want: ` + "`foo`" + `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+		},
+		{
+			name: "table case matched by map key",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for name, tt := range map[string]struct{ in, want string }{
+		"a": {"b", ""},
+		"b": {"a", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   9,
+			testName: "TestFoo/b",
+			got:      "foo\nbar",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	for name, tt := range map[string]struct{ in, want string }{
+		"a": {"b", ""},
+		"b": {"a", ` + "`" + `
+			foo
+			bar` + "`" + `},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+		},
+		{
+			name: "table case matched by index",
+			src: `package p
+
+type testCase struct {
+	in   int
+	want string
+}
+
+var tests = []*testCase{
+	{1, ""},
+	{2, ""},
+}
+
+func TestFoo(t *testing.T) {
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   16,
+			testName: "TestFoo/1",
+			got:      "foo",
+			want: `package p
+
+type testCase struct {
+	in   int
+	want string
+}
+
+var tests = []*testCase{
+	{1, ""},
+	{2, ` + "`foo`" + `},
+}
+
+func TestFoo(t *testing.T) {
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+		},
+		{
+			name: "table case matched only by the field given to t.Run",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ in, name, want string }{
+		{"b", "a", "B"},
+		{"q", "b", "B"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   9,
+			testName: "TestFoo/b",
+			got:      "Q",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ in, name, want string }{
+		{"b", "a", "B"},
+		{"q", "b", ` + "`Q`" + `},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+		},
+		{
+			name: "picks the Expect on the reported line",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect("")
+	c.Expect("")
+}
+`,
+			lineNo: 5,
+			got:    "foo",
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect("")
+	c.Expect(` + "`foo`" + `)
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := updateSource([]byte(tt.src), tt.lineNo, tt.testName, tt.got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, string(got), tt.want)
+		})
+	}
+}
+
+func Test_locateExpectation_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		lineNo   int
+		testName string
+		wantErr  string
+	}{
+		{
+			name:    "invalid source",
+			src:     "package p\nfunc {",
+			lineNo:  2,
+			wantErr: "parsing foo_test.go",
+		},
+		{
+			name: "no Expect on line",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Print("")
+}
+`,
+			lineNo:  4,
+			wantErr: "no Expect call found at foo_test.go:4",
+		},
+		{
+			name: "not a literal",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(want())
+}
+`,
+			lineNo:  4,
+			wantErr: "argument to Expect at foo_test.go:4 is not a string literal",
+		},
+		{
+			name: "table case outside of a subtest",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{{"a", ""}} {
+		c.Expect(tt.want)
+	}
+}
+`,
+			lineNo:   5,
+			testName: "TestFoo",
+			wantErr:  "argument to Expect at foo_test.go:5: TestFoo is not a subtest, so the running case of the table can't be found",
+		},
+		{
+			name: "table case not found",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{{"a", ""}} {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   6,
+			testName: "TestFoo/other",
+			wantErr:  `argument to Expect at foo_test.go:6: no case of the table is named "other", so the running case can't be found`,
+		},
+		{
+			name: "table case with a repeated name",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{
+		{"same", ""},
+		{"same", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   9,
+			testName: "TestFoo/same",
+			wantErr:  `argument to Expect at foo_test.go:9: 2 cases of the table are named "same", so the running case can't be told apart`,
+		},
+		{
+			name: "table subtest named by something else",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{{"a", ""}} {
+		t.Run("other", func(t *testing.T) {
+			c.Expect(tt.want)
+		})
+	}
+}
+`,
+			lineNo:   6,
+			testName: "TestFoo/other",
+			wantErr:  "argument to Expect at foo_test.go:6: the name given to t.Run isn't a field of tt, a map key or an index, so the running case can't be found",
+		},
+		{
+			name: "variable declared in another file",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	c.Expect(want)
+}
+`,
+			lineNo:  4,
+			wantErr: "argument to Expect at foo_test.go:4: want is not declared in this file",
+		},
+		{
+			name: "variable assigned twice",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	want := ""
+	if short {
+		want = "short"
+	}
+	c.Expect(want)
+}
+`,
+			lineNo:  8,
+			wantErr: "argument to Expect at foo_test.go:8: want is assigned more than once, so its value at the call can't be known",
+		},
+		{
+			name: "variable set from a function",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	want := strings.Repeat("a", 3)
+	c.Expect(want)
+}
+`,
+			lineNo:  5,
+			wantErr: "argument to Expect at foo_test.go:5: want is not set to a string literal",
+		},
+		{
+			name: "variable without a value",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	var want string
+	c.Expect(want)
+}
+`,
+			lineNo:  5,
+			wantErr: "argument to Expect at foo_test.go:5: want is not declared with a value of its own",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := updateSource([]byte(tt.src), tt.lineNo, tt.testName, "foo")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_locateExpectation_helpers(t *testing.T) {
+	helpers := `package p
+
+func expectHelper(c *IC, want string) {
+	c.Expect(want)
+}
+func expectMarkedHelper(t *testing.T, c *IC, name, want string) {
+	t.Helper()
+	c.Expect(strings.TrimSpace(want))
+}
+func expectUnmarkedHelper(c *IC, want string) {
+	c.Expect(strings.TrimSpace(want))
+}
+`
+	tests := []struct {
+		name    string
+		src     string
+		callers []callerFrame
+		skip    int
+		want    string
+	}{
+		{
+			name: "parameter passed straight to Expect",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	expectHelper(c, "")
+}
+`,
+			callers: []callerFrame{{"helpers_test.go", 4}, {"foo_test.go", 4}},
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	expectHelper(c, ` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "function literal assigned to a variable",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	expect := func(name, want string) {
+		c.Expect(want)
+	}
+	expect("name", "")
+}
+`,
+			callers: []callerFrame{{"foo_test.go", 5}, {"foo_test.go", 7}},
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	expect := func(name, want string) {
+		c.Expect(want)
+	}
+	expect("name", ` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "helper marked with t.Helper()",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	expectMarkedHelper(t, c, name, "")
+}
+`,
+			callers: []callerFrame{{"helpers_test.go", 8}, {"foo_test.go", 4}},
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	expectMarkedHelper(t, c, name, ` + "`foo`" + `)
+}
+`,
+		},
+		{
+			name: "caller skip",
+			src: `package p
+
+func TestFoo(t *testing.T) {
+	expectUnmarkedHelper(c, "")
+}
+`,
+			callers: []callerFrame{{"helpers_test.go", 11}, {"foo_test.go", 4}},
+			skip:    1,
+			want: `package p
+
+func TestFoo(t *testing.T) {
+	expectUnmarkedHelper(c, ` + "`foo`" + `)
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{
+				"helpers_test.go": []byte(helpers),
+				"foo_test.go":     []byte(tt.src),
+			}
+			loc, err := locateExpectation(tt.callers, tt.skip, "TestFoo", func(fName string) ([]byte, error) {
+				return files[fName], nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, loc.fName, "foo_test.go")
+			got, err := renderEdits(loc.fName, files[loc.fName], []textEdit{loc.edit("foo")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, string(got), tt.want)
+		})
+	}
+
+	t.Run("unmarked helper without caller skip", func(t *testing.T) {
+		files := map[string][]byte{"helpers_test.go": []byte(helpers)}
+		callers := []callerFrame{{"helpers_test.go", 11}, {"foo_test.go", 4}}
+		_, err := locateExpectation(callers, 0, "TestFoo", func(fName string) ([]byte, error) {
+			return files[fName], nil
+		})
+		wantErr := "argument to Expect at helpers_test.go:11 is not a string literal"
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, want %q", err, wantErr)
+		}
+	})
+}
+
+// updateSource updates the expectation of the Expect call at lineNo in src
+// made by the test testName
+func updateSource(src []byte, lineNo int, testName string, got string) ([]byte, error) {
+	callers := []callerFrame{{"foo_test.go", lineNo}}
+	loc, err := locateExpectation(callers, 0, testName, func(string) ([]byte, error) {
+		return src, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return renderEdits(loc.fName, src, []textEdit{loc.edit(got)})
+}
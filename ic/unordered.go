@@ -0,0 +1,87 @@
+package ic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// outputLines splits s into lines, leaving out the empty line after a final
+// newline
+func outputLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// compareUnordered compares the lines of want and got as multisets. It
+// returns the lines of want that got lacks, in the order of want, and the
+// lines of got that want lacks, in the order of got. A line repeated more
+// often on one side is listed as many times as it is extra.
+func compareUnordered(want, got []string) (missing, unexpected []string) {
+	counts := make(map[string]int)
+	for _, line := range got {
+		counts[line]++
+	}
+	for _, line := range want {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			missing = append(missing, line)
+		}
+	}
+	for _, line := range got {
+		if counts[line] > 0 {
+			counts[line]--
+			unexpected = append(unexpected, line)
+		}
+	}
+	return missing, unexpected
+}
+
+// describeUnordered explains how the lines of got differ from those of want
+// when order doesn't matter. Lines are quoted so that whitespace shows.
+func describeUnordered(missing, unexpected []string) string {
+	var sb strings.Builder
+	sb.WriteString("lines differ, ignoring order")
+	for _, list := range []struct {
+		title string
+		lines []string
+	}{{"missing from got", missing}, {"unexpected in got", unexpected}} {
+		if len(list.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:", list.title)
+		for _, line := range list.lines {
+			fmt.Fprintf(&sb, "\n  %q", line)
+		}
+	}
+	return sb.String()
+}
+
+// orderLike returns the lines of got in the order of want, so that rewriting
+// an unordered expectation only touches the lines that changed. Lines of want
+// that got lacks are dropped and lines want lacks are added at the end. The
+// result ends in a newline when got does.
+func orderLike(want, got string) string {
+	wantLines, gotLines := outputLines(want), outputLines(got)
+	missing, unexpected := compareUnordered(wantLines, gotLines)
+	toDrop := make(map[string]int)
+	for _, line := range missing {
+		toDrop[line]++
+	}
+	var lines []string
+	for _, line := range wantLines {
+		if toDrop[line] > 0 {
+			toDrop[line]--
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, unexpected...)
+	ordered := strings.Join(lines, "\n")
+	if strings.HasSuffix(got, "\n") {
+		ordered += "\n"
+	}
+	return ordered
+}
@@ -0,0 +1,35 @@
+package ic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_compareUnordered(t *testing.T) {
+	missing, unexpected := compareUnordered(
+		[]string{"a", "b", "b", "c"},
+		[]string{"c", "b", "d", "a", "d"},
+	)
+	if want := []string{"b"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("got missing %q, want %q", missing, want)
+	}
+	if want := []string{"d", "d"}; !reflect.DeepEqual(unexpected, want) {
+		t.Errorf("got unexpected %q, want %q", unexpected, want)
+	}
+}
+
+func Test_orderLike(t *testing.T) {
+	tests := []struct {
+		name, want, got, wantResult string
+	}{
+		{"same lines", "a\nb\n", "b\na\n", "a\nb\n"},
+		{"line changed", "a\nb\nc\n", "c\nx\na\n", "a\nc\nx\n"},
+		{"repeated line", "a\na\nb", "b\na", "a\nb"},
+		{"empty got", "a\n", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, orderLike(tt.want, tt.got), tt.wantResult)
+		})
+	}
+}